@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mattgill98/vault-init/pkg/bootstrap"
+)
+
+var (
+	// auditCheck verifies that Vault has an audit device on every loop, unless
+	// VAULT_AUDIT_CHECK is set to false
+	auditCheck          = !strings.EqualFold(os.Getenv("VAULT_AUDIT_CHECK"), "false")
+	auditDevicesMissing = false
+	auditCheckError     = ""
+)
+
+// CheckAuditDevices warns when Vault no longer has any audit device enabled
+func CheckAuditDevices(ctx context.Context) {
+	token, err := getOperatorToken()
+	if err != nil {
+		reportAuditCheckError(err)
+		return
+	}
+
+	count, err := bootstrap.CountAuditDevices(ctx, vaultClient, token)
+	if err != nil {
+		reportAuditCheckError(err)
+		return
+	}
+	auditCheckError = ""
+	if count == 0 {
+		// Only report the transition, rather than on every loop
+		if !auditDevicesMissing {
+			log.Println("Warning: Vault has no audit devices enabled")
+			RecordAuditEvent("audit-devices-missing", nil)
+		}
+		auditDevicesMissing = true
+		return
+	}
+	if auditDevicesMissing {
+		log.Printf("Vault audit logging restored, %d audit devices enabled", count)
+	}
+	auditDevicesMissing = false
+}
+
+// reportAuditCheckError logs why the audit devices could not be checked. As the
+// check is on by default, the same error is not repeated on every loop.
+func reportAuditCheckError(err error) {
+	if err.Error() != auditCheckError || debugLogging {
+		log.Printf("Unable to check audit devices: %v", err)
+	}
+	auditCheckError = err.Error()
+}
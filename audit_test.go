@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckAuditDevices_ReportsTransitions(t *testing.T) {
+	defer func() { auditDevicesMissing = false }()
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, RootToken: "root"}, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("Read", mock.Anything, "root", "sys/audit").Once().Return(map[string]interface{}{}, nil)
+	mockVault.On("Read", mock.Anything, "root", "sys/audit").Once().Return(map[string]interface{}{
+		"file/": map[string]interface{}{"type": "file"},
+	}, nil)
+
+	CheckAuditDevices(context.Background())
+	assert.True(t, auditDevicesMissing)
+	CheckAuditDevices(context.Background())
+	assert.False(t, auditDevicesMissing)
+}
+
+func TestCheckAuditDevices_RootTokenRevoked(t *testing.T) {
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, RootTokenRevoked: true}, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+
+	CheckAuditDevices(context.Background())
+	mockVault.AssertNotCalled(t, "Read", mock.Anything, mock.Anything, mock.Anything)
+}
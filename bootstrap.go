@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/bootstrap"
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	DEFAULT_BOOTSTRAP_INTERVAL = time.Hour
+	BOOTSTRAP_RETRY_INTERVAL   = time.Minute
+)
+
+// BootstrapStep configures a freshly initialized Vault using its root token
+type BootstrapStep func(ctx context.Context, rootToken string) error
+
+var (
+	ErrNoOperatorToken = errors.New("The root token has been revoked and VAULT_TOKEN is not set")
+
+	revokeRootToken = GetRevokeRootToken()
+	bootstrapSteps  = []BootstrapStep{}
+
+	// bootstrapInterval is the time between re-applying the bootstrap steps to
+	// reconcile drift, 0 only applies them until they have succeeded once
+	bootstrapInterval = getDurationEnv("VAULT_BOOTSTRAP_INTERVAL", DEFAULT_BOOTSTRAP_INTERVAL)
+	// The bootstrap steps are pending until they succeed in this process, so a
+	// bootstrap that failed or was interrupted before a restart is retried
+	bootstrapped     bool
+	nextBootstrap    time.Time
+	bootstrapSkipped bool
+)
+
+// GetRevokeRootToken reports whether the root token should be revoked once
+// bootstrap has completed instead of being stored with the keys
+func GetRevokeRootToken() bool {
+	return strings.EqualFold(os.Getenv("VAULT_REVOKE_ROOT_TOKEN"), "true")
+}
+
+// GetBootstrapSteps reads the steps applied to a freshly initialized Vault
+func GetBootstrapSteps() ([]BootstrapStep, error) {
+	steps := []BootstrapStep{}
+	if path := os.Getenv("VAULT_BOOTSTRAP_FILE"); path != "" {
+		config, err := bootstrap.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, func(ctx context.Context, rootToken string) error {
+			return bootstrap.Apply(ctx, vaultClient, rootToken, config)
+		})
+	}
+	return steps, nil
+}
+
+// BootstrapVault runs the bootstrap steps against an unsealed Vault. In hardened
+// mode it then revokes the root token and records the revocation in storage. The
+// token is revoked even if a step fails, as it has not been stored anywhere.
+func BootstrapVault(ctx context.Context, state vault.InitState) (bool, error) {
+	if len(bootstrapSteps) == 0 && !revokeRootToken {
+		return true, nil
+	}
+
+	rootToken, err := getRootToken(state)
+	if err != nil {
+		return false, err
+	}
+	if err := waitForActive(ctx); err != nil {
+		return false, err
+	}
+
+	bootstrapErr := runBootstrapSteps(ctx, rootToken)
+	if bootstrapErr == nil {
+		markBootstrapped(time.Now())
+	}
+	if !revokeRootToken {
+		if bootstrapErr != nil {
+			return false, fmt.Errorf("Bootstrap failed: %w", bootstrapErr)
+		}
+		return true, nil
+	}
+
+	log.Println("Revoking the root token...")
+	if err := vaultClient.RevokeSelf(ctx, rootToken); err != nil {
+		return false, fmt.Errorf("Failed to revoke the root token: %w", err)
+	}
+	state.RootToken = ""
+	state.RootTokenFingerprint = ""
+	state.RootTokenRevoked = true
+	if ok, err := SaveState(state); !ok {
+		return false, err
+	}
+	RecordAuditEvent("revoke-root", nil)
+
+	if bootstrapErr != nil {
+		return false, fmt.Errorf("Bootstrap failed, use generate-root to retry: %w", bootstrapErr)
+	}
+	return true, nil
+}
+
+func runBootstrapSteps(ctx context.Context, rootToken string) error {
+	log.Println("Bootstrapping Vault...")
+	for _, step := range bootstrapSteps {
+		if err := step(ctx, rootToken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckBootstrap applies the bootstrap steps while they are pending, and then once
+// per bootstrap interval to reconcile drift. It uses the operator token, as the
+// root token may have been revoked by a failed hardened bootstrap.
+func CheckBootstrap(ctx context.Context) {
+	now := time.Now()
+	if len(bootstrapSteps) == 0 || (bootstrapped && bootstrapInterval == 0) || now.Before(nextBootstrap) {
+		return
+	}
+
+	token, err := getOperatorToken()
+	if errors.Is(err, ErrNoOperatorToken) {
+		// Without a token the steps can never succeed, so this is not a failure
+		if !bootstrapSkipped {
+			log.Println("Skipping bootstrap reconciliation: the root token has been revoked and VAULT_TOKEN is not set")
+		}
+		bootstrapSkipped = true
+		nextBootstrap = now.Add(BOOTSTRAP_RETRY_INTERVAL)
+		return
+	}
+	bootstrapSkipped = false
+	if err == nil {
+		err = runBootstrapSteps(ctx, token)
+	}
+	if err != nil {
+		log.Printf("Bootstrap failed: %v", err)
+		metricsRegistry.Add("vault_init_bootstrap_failures_total", "Number of failed bootstrap runs", 1)
+		nextBootstrap = now.Add(BOOTSTRAP_RETRY_INTERVAL)
+		return
+	}
+	markBootstrapped(now)
+}
+
+func markBootstrapped(now time.Time) {
+	bootstrapped = true
+	nextBootstrap = now.Add(bootstrapInterval)
+	metricsRegistry.Set("vault_init_last_bootstrap_time_seconds", "Unix time the bootstrap steps last succeeded", float64(now.Unix()))
+}
+
+// Bootstrap re-applies the bootstrap steps using the stored root token, reconciling any drift
+func Bootstrap(ctx context.Context) error {
+	state, err := keyStorage.Fetch()
+	if err != nil {
+		return fmt.Errorf("Failed to fetch keys: %w", err)
+	}
+	if state.RootTokenRevoked {
+		return fmt.Errorf("The root token has been revoked, use generate-root -store first")
+	}
+	rootToken, err := getRootToken(*state)
+	if err != nil {
+		return err
+	}
+	return runBootstrapSteps(ctx, rootToken)
+}
+
+func getRootToken(state vault.InitState) (string, error) {
+	if state.RootTokenFingerprint == "" {
+		return state.RootToken, nil
+	}
+	tokens, err := decryptKeys("root token", []string{state.RootToken}, []string{state.RootTokenFingerprint})
+	if err != nil {
+		return "", err
+	}
+	return tokens[0], nil
+}
+
+// waitForActive waits for Vault to accept requests after being unsealed, which
+// takes a moment when Vault unseals itself
+func waitForActive(ctx context.Context) error {
+	for {
+		state, err := vaultClient.HealthCheck(ctx)
+		if err == nil && IsUnsealed(state) {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sleep(ctx, time.Second)
+	}
+}
+
+// getOperatorToken returns the token used for periodic maintenance: VAULT_TOKEN
+// if set, otherwise the stored root token
+func getOperatorToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	state, err := keyStorage.Fetch()
+	if err != nil {
+		return "", err
+	}
+	if state.RootTokenRevoked {
+		return "", ErrNoOperatorToken
+	}
+	return getRootToken(*state)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/secret"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReconcileVault_RevokesRootToken(t *testing.T) {
+	revokeRootToken = true
+	defer func() { revokeRootToken = false }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("Initialize", mock.Anything, initOptions).Once().Return(vault.InitState{Keys: []string{"a"}, Threshold: 1, RootToken: "root"}, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+	mockVault.On("HealthCheck", mock.Anything).Return(vault.HealthState{Active: true}, nil)
+	mockVault.On("RevokeSelf", mock.Anything, "root").Once().Return(nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Once().Return((*vault.InitState)(nil), secret.ErrKeysNotFound)
+	mockKeyStorage.On("Persist", vault.InitState{Keys: []string{"a"}, Threshold: 1}).Once().Return(true, nil)
+	mockKeyStorage.On("Persist", vault.InitState{Keys: []string{"a"}, Threshold: 1, RootTokenRevoked: true}).Once().Return(true, nil)
+
+	var bootstrapToken string
+	bootstrapSteps = []BootstrapStep{func(ctx context.Context, rootToken string) error {
+		bootstrapToken = rootToken
+		return nil
+	}}
+	defer func() { bootstrapSteps = []BootstrapStep{} }()
+
+	ok, err := ReconcileVault(context.Background(), address, vault.HealthState{Uninitialized: true})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.Equal(t, "root", bootstrapToken)
+	mockKeyStorage.AssertNumberOfCalls(t, "Persist", 2)
+	mockVault.AssertCalled(t, "RevokeSelf", mock.Anything, "root")
+}
+
+func TestBootstrapVault_RevokesAfterFailure(t *testing.T) {
+	revokeRootToken = true
+	defer func() { revokeRootToken = false }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("HealthCheck", mock.Anything).Return(vault.HealthState{Active: true}, nil)
+	mockVault.On("RevokeSelf", mock.Anything, "root").Once().Return(nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Persist", vault.InitState{Keys: []string{"a"}, RootTokenRevoked: true}).Once().Return(true, nil)
+
+	bootstrapSteps = []BootstrapStep{func(ctx context.Context, rootToken string) error {
+		return fmt.Errorf("Mock error")
+	}}
+	defer func() { bootstrapSteps = []BootstrapStep{} }()
+
+	ok, err := BootstrapVault(context.Background(), vault.InitState{Keys: []string{"a"}, RootToken: "root"})
+	assert.False(t, ok)
+	assert.Contains(t, err.Error(), "generate-root")
+	mockVault.AssertCalled(t, "RevokeSelf", mock.Anything, "root")
+}
+
+func TestBootstrap_RootTokenRevoked(t *testing.T) {
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, RootTokenRevoked: true}, nil)
+
+	err := Bootstrap(context.Background())
+	assert.Contains(t, err.Error(), "revoked")
+}
+
+func TestCheckBootstrap_RetriesPendingSteps(t *testing.T) {
+	bootstrapped, nextBootstrap = false, time.Time{}
+	defer func() { bootstrapSteps, bootstrapped, nextBootstrap = []BootstrapStep{}, false, time.Time{} }()
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, RootToken: "root"}, nil)
+
+	calls := 0
+	bootstrapSteps = []BootstrapStep{func(ctx context.Context, rootToken string) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("Mock error")
+		}
+		return nil
+	}}
+
+	CheckBootstrap(context.Background())
+	assert.False(t, bootstrapped)
+	assert.Equal(t, 1.0, metricsRegistry.Value("vault_init_bootstrap_failures_total"))
+
+	// Not retried before the retry interval has passed
+	CheckBootstrap(context.Background())
+	assert.Equal(t, 1, calls)
+
+	nextBootstrap = time.Time{}
+	CheckBootstrap(context.Background())
+	assert.True(t, bootstrapped)
+	assert.Equal(t, 2, calls)
+	assert.WithinDuration(t, time.Now().Add(bootstrapInterval), nextBootstrap, time.Minute)
+}
+
+func TestCheckBootstrap_SkipsWithoutOperatorToken(t *testing.T) {
+	revokeRootToken, bootstrapped, nextBootstrap = true, false, time.Time{}
+	defer func() {
+		revokeRootToken, bootstrapped, nextBootstrap, bootstrapSkipped = false, false, time.Time{}, false
+		bootstrapSteps = []BootstrapStep{}
+	}()
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, RootTokenRevoked: true}, nil)
+
+	calls := 0
+	bootstrapSteps = []BootstrapStep{func(ctx context.Context, rootToken string) error {
+		calls++
+		return nil
+	}}
+
+	failures := metricsRegistry.Value("vault_init_bootstrap_failures_total")
+	for i := 0; i < 3; i++ {
+		nextBootstrap = time.Time{}
+		CheckBootstrap(context.Background())
+	}
+	assert.Equal(t, 0, calls)
+	assert.True(t, bootstrapSkipped)
+	assert.False(t, bootstrapped)
+	assert.Equal(t, failures, metricsRegistry.Value("vault_init_bootstrap_failures_total"))
+}
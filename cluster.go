@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	DEFAULT_VAULT_PORT = "8200"
+)
+
+// ClusterNode tracks a single member of a Vault cluster and its last observed health
+type ClusterNode struct {
+	Address   string
+	Client    vault.Vault
+	State     vault.HealthState
+	Reachable bool
+}
+
+var (
+	clusterNodes      = map[string]*ClusterNode{}
+	lookupHost        = net.LookupHost
+	createVaultClient = func(address string) (vault.Vault, error) { return vault.NewVaultClient(GetClientConfig(address)) }
+)
+
+// IsClusterMode reports whether a list of cluster members has been configured
+func IsClusterMode() bool {
+	return os.Getenv("VAULT_CLUSTER_ADDRS") != "" || os.Getenv("VAULT_CLUSTER_DNS") != ""
+}
+
+// GetClusterAddresses returns the configured node addresses, or resolves the
+// headless service name to the address of every peer. Resolved peers use the
+// scheme and port of VAULT_ADDR.
+func GetClusterAddresses() ([]string, error) {
+	if addresses := getListEnv("VAULT_CLUSTER_ADDRS"); len(addresses) > 0 {
+		return addresses, nil
+	}
+
+	serviceName := os.Getenv("VAULT_CLUSTER_DNS")
+	hosts, err := lookupHost(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve cluster members: %w", err)
+	}
+
+	base, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Vault address: %w", err)
+	}
+	port := base.Port()
+	if port == "" {
+		port = DEFAULT_VAULT_PORT
+	}
+
+	addresses := []string{}
+	for _, host := range hosts {
+		addresses = append(addresses, fmt.Sprintf("%v://%v", base.Scheme, net.JoinHostPort(host, port)))
+	}
+	return addresses, nil
+}
+
+// runCluster checks the health of every member, then initializes or unseals each
+// one independently, logging members which fail rather than giving up on the
+// others. Only a single member is ever initialized: the others either join the
+// configured Raft leaders or are left alone to join by themselves.
+func runCluster(ctx context.Context) (bool, error) {
+	addresses, err := GetClusterAddresses()
+	if err != nil {
+		log.Println(err)
+		return true, nil
+	}
+
+	nodes := []*ClusterNode{}
+	clusterInitialized := false
+	for _, address := range addresses {
+		node, err := getClusterNode(address)
+		if err != nil {
+			return false, err
+		}
+		checkClusterNode(ctx, node)
+		if node.Reachable && !node.State.Uninitialized {
+			clusterInitialized = true
+		}
+		nodes = append(nodes, node)
+	}
+	checkClusterConsistency(nodes)
+
+	for _, node := range nodes {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if !node.Reachable {
+			continue
+		}
+		if node.State.Uninitialized && clusterInitialized && len(raftLeaderAddresses) == 0 {
+			log.Printf("[%v] Waiting for node to join the initialized cluster", node.Address)
+			continue
+		}
+
+		vaultClient = node.Client
+		ok, err := ReconcileVault(ctx, node.Address, node.State)
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if node.State.Uninitialized {
+			// Even a failed initialization may have initialized Vault, so another
+			// member is never initialized in the same pass
+			clusterInitialized = true
+		}
+		if !ok {
+			// A failing member must not stop the others from being unsealed
+			log.Printf("[%v] %v", node.Address, err)
+			metricsRegistry.Add("vault_init_node_failures_total", "Number of failed attempts to initialize, join or unseal a cluster member", 1)
+		}
+	}
+
+	// Maintenance applies to the whole cluster, so it only runs against the active node
+	for _, node := range nodes {
+		if node.Reachable && node.State.Active {
+			vaultClient = node.Client
+			runMaintenance(ctx, node.State)
+			break
+		}
+	}
+
+	return true, nil
+}
+
+func getClusterNode(address string) (*ClusterNode, error) {
+	if node, ok := clusterNodes[address]; ok {
+		return node, nil
+	}
+	client, err := createVaultClient(address)
+	if err != nil {
+		return nil, err
+	}
+	node := &ClusterNode{Address: address, Client: client}
+	clusterNodes[address] = node
+	return node, nil
+}
+
+// checkClusterNode refreshes the health of a node, logging whenever it changes
+func checkClusterNode(ctx context.Context, node *ClusterNode) {
+	state, err := node.Client.HealthCheck(ctx)
+	if err != nil {
+		if node.Reachable || debugLogging {
+			log.Printf("[%v] %v", node.Address, err)
+		}
+		node.Reachable = false
+		return
+	}
+
+	if !node.Reachable || state != node.State || debugLogging {
+		log.Printf("[%v] %v", node.Address, DescribeHealthState(state))
+	}
+	node.Reachable = true
+	node.State = state
+}
+
+// checkClusterConsistency warns when initialized members report different cluster
+// IDs, which means some of them have formed a separate cluster
+func checkClusterConsistency(nodes []*ClusterNode) bool {
+	clusters := map[string][]string{}
+	for _, node := range nodes {
+		if node.Reachable && node.State.Details.ClusterID != "" {
+			clusters[node.State.Details.ClusterID] = append(clusters[node.State.Details.ClusterID], node.Address)
+		}
+	}
+	if len(clusters) > 1 {
+		log.Printf("Warning: cluster members belong to %d different clusters: %v", len(clusters), clusters)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/secret"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func useClusterMocks(mocks map[string]*mocking.VaultMock) {
+	clusterNodes = map[string]*ClusterNode{}
+	createVaultClient = func(address string) (vault.Vault, error) {
+		client, ok := mocks[address]
+		if !ok {
+			return nil, fmt.Errorf("Unexpected address %v", address)
+		}
+		return client, nil
+	}
+}
+
+func TestGetClusterAddresses_List(t *testing.T) {
+	os.Setenv("VAULT_CLUSTER_ADDRS", "http://vault-0:8200, http://vault-1:8200")
+	defer os.Unsetenv("VAULT_CLUSTER_ADDRS")
+
+	addresses, err := GetClusterAddresses()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://vault-0:8200", "http://vault-1:8200"}, addresses)
+}
+
+func TestGetClusterAddresses_DNS(t *testing.T) {
+	os.Setenv("VAULT_CLUSTER_DNS", "vault-internal")
+	defer os.Unsetenv("VAULT_CLUSTER_DNS")
+	address = "https://vault:8300"
+	defer func() { address = DEFAULT_VAULT_ADDR }()
+	lookupHost = func(host string) ([]string, error) {
+		assert.Equal(t, "vault-internal", host)
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+
+	addresses, err := GetClusterAddresses()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://10.0.0.1:8300", "https://10.0.0.2:8300"}, addresses)
+}
+
+func TestRunCluster_InitializesSingleNode(t *testing.T) {
+	os.Setenv("VAULT_CLUSTER_ADDRS", "http://vault-0:8200,http://vault-1:8200")
+	defer os.Unsetenv("VAULT_CLUSTER_ADDRS")
+
+	first := new(mocking.VaultMock)
+	second := new(mocking.VaultMock)
+	useClusterMocks(map[string]*mocking.VaultMock{"http://vault-0:8200": first, "http://vault-1:8200": second})
+
+	mockState := vault.InitState{Keys: []string{"a"}, Threshold: 1}
+	first.On("HealthCheck", mock.Anything).Return(vault.HealthState{Uninitialized: true}, nil)
+	first.On("Initialize", mock.Anything, initOptions).Once().Return(mockState, nil)
+	first.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	first.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+	second.On("HealthCheck", mock.Anything).Return(vault.HealthState{Uninitialized: true}, nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Once().Return((*vault.InitState)(nil), secret.ErrKeysNotFound)
+	mockKeyStorage.On("Persist", mockState).Once().Return(true, nil)
+
+	ok, err := runCluster(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	first.AssertCalled(t, "Initialize", mock.Anything, initOptions)
+	second.AssertNotCalled(t, "Initialize", mock.Anything, mock.Anything)
+}
+
+func TestRunCluster_UnsealsEachNode(t *testing.T) {
+	os.Setenv("VAULT_CLUSTER_ADDRS", "http://vault-0:8200,http://vault-1:8200,http://vault-2:8200")
+	defer os.Unsetenv("VAULT_CLUSTER_ADDRS")
+
+	active := new(mocking.VaultMock)
+	sealed := new(mocking.VaultMock)
+	down := new(mocking.VaultMock)
+	useClusterMocks(map[string]*mocking.VaultMock{"http://vault-0:8200": active, "http://vault-1:8200": sealed, "http://vault-2:8200": down})
+
+	active.On("HealthCheck", mock.Anything).Return(vault.HealthState{Active: true}, nil)
+	active.On("Read", mock.Anything, mock.Anything, "sys/audit").Return(map[string]interface{}{"file/": map[string]interface{}{"type": "file"}}, nil)
+	sealed.On("HealthCheck", mock.Anything).Return(vault.HealthState{Sealed: true}, nil)
+	sealed.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	sealed.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+	down.On("HealthCheck", mock.Anything).Return(vault.HealthState{}, fmt.Errorf("Connection refused"))
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}}, nil)
+
+	ok, err := runCluster(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	active.AssertNotCalled(t, "Unseal", mock.Anything, mock.Anything)
+	sealed.AssertCalled(t, "Unseal", mock.Anything, "a")
+	assert.False(t, clusterNodes["http://vault-2:8200"].Reachable)
+	assert.True(t, clusterNodes["http://vault-1:8200"].State.Sealed)
+}
+
+func TestRunCluster_ContinuesAfterNodeFailure(t *testing.T) {
+	os.Setenv("VAULT_CLUSTER_ADDRS", "http://vault-0:8200,http://vault-1:8200")
+	defer os.Unsetenv("VAULT_CLUSTER_ADDRS")
+
+	failing := new(mocking.VaultMock)
+	sealed := new(mocking.VaultMock)
+	useClusterMocks(map[string]*mocking.VaultMock{"http://vault-0:8200": failing, "http://vault-1:8200": sealed})
+
+	failing.On("HealthCheck", mock.Anything).Return(vault.HealthState{Sealed: true}, nil)
+	failing.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	failing.On("Unseal", mock.Anything, "a").Return(vault.UnsealState{}, fmt.Errorf("Mock error"))
+	sealed.On("HealthCheck", mock.Anything).Return(vault.HealthState{Sealed: true}, nil)
+	sealed.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	sealed.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}}, nil)
+
+	ok, err := runCluster(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	failing.AssertCalled(t, "Unseal", mock.Anything, "a")
+	sealed.AssertCalled(t, "Unseal", mock.Anything, "a")
+}
+
+func TestCheckClusterConsistency(t *testing.T) {
+	nodes := []*ClusterNode{
+		{Address: "a", Reachable: true, State: vault.HealthState{Details: vault.HealthResponse{ClusterID: "1"}}},
+		{Address: "b", Reachable: true, State: vault.HealthState{Details: vault.HealthResponse{ClusterID: "2"}}},
+		{Address: "c", Reachable: false},
+	}
+	assert.False(t, checkClusterConsistency(nodes))
+	assert.True(t, checkClusterConsistency(nodes[1:]))
+}
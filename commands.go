@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// RunCommand runs a one-off operation instead of the reconciliation loop
+func RunCommand(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "rekey":
+		return Rekey(ctx)
+	case "bootstrap":
+		return Bootstrap(ctx)
+	case "restore":
+		return runRestore(ctx, args)
+	case "generate-root":
+		return runGenerateRoot(ctx, args)
+	default:
+		return fmt.Errorf("Unknown command %q", command)
+	}
+}
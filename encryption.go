@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattgill98/vault-init/pkg/secret"
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	DEFAULT_KEK_SECRET_KEY    = "key"
+	DEFAULT_KEK_TRANSIT_MOUNT = "transit"
+)
+
+// GetKeyEncrypter reads the key encryption key provider named by VAULT_KEY_ENCRYPTION,
+// returning nil when the stored keys should not be encrypted
+func GetKeyEncrypter() (secret.KeyEncrypter, error) {
+	switch provider := strings.ToLower(os.Getenv("VAULT_KEY_ENCRYPTION")); provider {
+	case "":
+		return nil, nil
+	case "file":
+		path := os.Getenv("VAULT_KEK_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("VAULT_KEK_FILE must be set to use file key encryption")
+		}
+		return secret.NewFileKeyEncrypter(path)
+	case "env":
+		key := os.Getenv("VAULT_KEK")
+		if key == "" {
+			return nil, fmt.Errorf("VAULT_KEK must be set to use env key encryption")
+		}
+		return secret.NewStaticKeyEncrypter([]byte(key))
+	case "kubernetes":
+		name := os.Getenv("VAULT_KEK_SECRET_NAME")
+		if name == "" {
+			return nil, fmt.Errorf("VAULT_KEK_SECRET_NAME must be set to use kubernetes key encryption")
+		}
+		namespace := os.Getenv("VAULT_KEK_SECRET_NAMESPACE")
+		if namespace == "" {
+			namespace = secret.CurrentNamespace()
+		}
+		dataKey := os.Getenv("VAULT_KEK_SECRET_KEY")
+		if dataKey == "" {
+			dataKey = DEFAULT_KEK_SECRET_KEY
+		}
+		return secret.NewKubernetesKeyEncrypter(name, namespace, dataKey)
+	case "transit":
+		return getTransitKeyEncrypter()
+	default:
+		return nil, fmt.Errorf("Unknown key encryption provider %q", provider)
+	}
+}
+
+// getTransitKeyEncrypter connects to the Vault holding the transit key, which
+// must not be the Vault being unsealed. The TLS settings are shared with it.
+func getTransitKeyEncrypter() (secret.KeyEncrypter, error) {
+	transitAddress := os.Getenv("VAULT_KEK_TRANSIT_ADDR")
+	keyName := os.Getenv("VAULT_KEK_TRANSIT_KEY")
+	if transitAddress == "" || keyName == "" {
+		return nil, fmt.Errorf("VAULT_KEK_TRANSIT_ADDR and VAULT_KEK_TRANSIT_KEY must be set to use transit key encryption")
+	}
+	if strings.TrimRight(transitAddress, "/") == strings.TrimRight(address, "/") {
+		return nil, fmt.Errorf("VAULT_KEK_TRANSIT_ADDR must not be the Vault being unsealed")
+	}
+
+	token := os.Getenv("VAULT_KEK_TRANSIT_TOKEN")
+	if path := os.Getenv("VAULT_KEK_TRANSIT_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read transit token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_KEK_TRANSIT_TOKEN or VAULT_KEK_TRANSIT_TOKEN_FILE must be set to use transit key encryption")
+	}
+
+	mount := os.Getenv("VAULT_KEK_TRANSIT_MOUNT")
+	if mount == "" {
+		mount = DEFAULT_KEK_TRANSIT_MOUNT
+	}
+
+	client, err := vault.NewVaultClient(vault.ClientConfig{
+		Address:  transitAddress,
+		TLS:      tlsConfig,
+		Timeouts: timeouts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secret.NewTransitKeyEncrypter(client, token, strings.Trim(mount, "/"), keyName), nil
+}
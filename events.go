@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// AuditEvent records a security relevant action taken by vault-init
+type AuditEvent struct {
+	Time    time.Time         `json:"time"`
+	Action  string            `json:"action"`
+	Address string            `json:"address"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+var (
+	auditLogger = log.New(os.Stderr, "AUDIT ", log.LstdFlags|log.LUTC)
+)
+
+// RecordAuditEvent writes a structured audit event, one JSON object per line
+func RecordAuditEvent(action string, details map[string]string) {
+	event := AuditEvent{
+		Time:    time.Now().UTC(),
+		Action:  action,
+		Address: address,
+		Details: details,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to record audit event %v: %v", action, err)
+		return
+	}
+	auditLogger.Println(string(data))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+var (
+	rootTokenOutput io.Writer = os.Stdout
+)
+
+// GenerateRoot is the break-glass procedure for when the stored root token has been
+// revoked: it generates a new root token using the stored unseal (or recovery) keys
+func GenerateRoot(ctx context.Context, store bool) error {
+	state, err := keyStorage.Fetch()
+	if err != nil {
+		return fmt.Errorf("Failed to fetch keys: %w", err)
+	}
+
+	var keys []string
+	if initOptions.AutoUnseal {
+		keys, err = GetRecoveryKeys(*state)
+	} else {
+		keys, err = GetUnsealKeys(*state)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Println("Starting root token generation...")
+	attempt, err := vaultClient.GenerateRootInit(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to start root token generation: %w", err)
+	}
+
+	var result vault.GenerateRootState
+	for index, key := range keys {
+		result, err = vaultClient.GenerateRootUpdate(ctx, key, attempt.Nonce)
+		if err != nil {
+			cancelGenerateRoot(ctx)
+			return fmt.Errorf("Root token generation failed with key [%d]: %w", index, err)
+		}
+		log.Printf("Root token generation progress: [%d/%d]", result.Progress, result.Required)
+		if result.Complete {
+			break
+		}
+	}
+	if !result.Complete {
+		cancelGenerateRoot(ctx)
+		return fmt.Errorf("Not enough keys to generate a root token")
+	}
+
+	token, err := vault.DecodeRootToken(result.EncodedToken, attempt.OTP)
+	if err != nil {
+		return err
+	}
+
+	if store {
+		state.RootToken = token
+		state.RootTokenFingerprint = ""
+		state.RootTokenRevoked = false
+		if ok, err := keyStorage.Persist(*state); !ok {
+			return fmt.Errorf("Failed to store root token: %w", err)
+		}
+		RecordAuditEvent("generate-root", map[string]string{"output": "storage"})
+		log.Println("New root token stored")
+		return nil
+	}
+
+	RecordAuditEvent("generate-root", map[string]string{"output": "stdout"})
+	fmt.Fprintln(rootTokenOutput, token)
+	return nil
+}
+
+func cancelGenerateRoot(ctx context.Context) {
+	if err := vaultClient.GenerateRootCancel(ctx); err != nil {
+		log.Printf("Failed to cancel root token generation: %v", err)
+	}
+}
+
+func runGenerateRoot(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("generate-root", flag.ContinueOnError)
+	store := flags.Bool("store", false, "Store the new root token instead of printing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return GenerateRoot(ctx, *store)
+}
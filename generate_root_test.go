@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func encodeRootToken(token string, otp string) string {
+	encoded := make([]byte, len(token))
+	for index := range encoded {
+		encoded[index] = token[index] ^ otp[index]
+	}
+	return base64.RawStdEncoding.EncodeToString(encoded)
+}
+
+func TestGenerateRoot_Print(t *testing.T) {
+	output := &bytes.Buffer{}
+	rootTokenOutput = output
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a", "b", "c"}, Threshold: 2}, nil)
+
+	otp := "0123456789"
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("GenerateRootInit", mock.Anything).Once().Return(vault.GenerateRootState{Nonce: "n", OTP: otp, Required: 2}, nil)
+	mockVault.On("GenerateRootUpdate", mock.Anything, "a", "n").Once().Return(vault.GenerateRootState{Progress: 1, Required: 2}, nil)
+	mockVault.On("GenerateRootUpdate", mock.Anything, "b", "n").Once().Return(vault.GenerateRootState{Complete: true, EncodedToken: encodeRootToken("hvs.tokens", otp)}, nil)
+
+	err := GenerateRoot(context.Background(), false)
+	assert.Nil(t, err)
+	assert.Equal(t, "hvs.tokens\n", output.String())
+	mockVault.AssertNotCalled(t, "GenerateRootUpdate", mock.Anything, "c", mock.Anything)
+	mockKeyStorage.AssertNotCalled(t, "Persist", mock.Anything)
+}
+
+func TestGenerateRoot_Store(t *testing.T) {
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, Threshold: 1, RootTokenFingerprint: "abc"}, nil)
+	mockKeyStorage.On("Persist", vault.InitState{Keys: []string{"a"}, Threshold: 1, RootToken: "hvs.tokens"}).Once().Return(true, nil)
+
+	otp := "0123456789"
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("GenerateRootInit", mock.Anything).Once().Return(vault.GenerateRootState{Nonce: "n", OTP: otp, Required: 1}, nil)
+	mockVault.On("GenerateRootUpdate", mock.Anything, "a", "n").Once().Return(vault.GenerateRootState{Complete: true, EncodedToken: encodeRootToken("hvs.tokens", otp)}, nil)
+
+	err := GenerateRoot(context.Background(), true)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertNumberOfCalls(t, "Persist", 1)
+}
+
+func TestGenerateRoot_UpdateError(t *testing.T) {
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, Threshold: 1}, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("GenerateRootInit", mock.Anything).Once().Return(vault.GenerateRootState{Nonce: "n"}, nil)
+	mockVault.On("GenerateRootUpdate", mock.Anything, "a", "n").Once().Return(vault.GenerateRootState{}, fmt.Errorf("Mock error"))
+	mockVault.On("GenerateRootCancel", mock.Anything).Once().Return(nil)
+
+	err := GenerateRoot(context.Background(), false)
+	assert.NotNil(t, err)
+	mockVault.AssertCalled(t, "GenerateRootCancel", mock.Anything)
+}
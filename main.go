@@ -1,31 +1,78 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/mattgill98/vault-init/pkg/metrics"
+	"github.com/mattgill98/vault-init/pkg/pgp"
 	"github.com/mattgill98/vault-init/pkg/secret"
 	"github.com/mattgill98/vault-init/pkg/vault"
+	v1 "k8s.io/api/core/v1"
 )
 
 const (
-	DEFAULT_VAULT_ADDR = "http://127.0.0.1:8200"
+	DEFAULT_VAULT_ADDR       = "http://127.0.0.1:8200"
+	DEFAULT_SECRET_SHARES    = 5
+	DEFAULT_SECRET_THRESHOLD = 3
+	DEFAULT_CLIENT_TIMEOUT   = 60 * time.Second
+	DEFAULT_HEALTH_TIMEOUT   = 5 * time.Second
+	DEFAULT_KEY_FILE         = "/var/lib/vault-init/keys.json"
 )
 
 var (
-	address                 = GetVaultAddress()
-	debugLogging            = GetDebugLogging()
-	vaultClient             vault.Vault
-	keyStorage              secret.KeyStorage
-	createKubernetesStorage = func() (secret.KeyStorage, error) { return secret.NewKubernetesSecretStorage("vault-keys", "default") }
-	createInMemoryStorage   = func() secret.KeyStorage { return secret.NewMemorySecretStorage(log.Default()) }
+	address              = GetVaultAddress()
+	debugLogging         = GetDebugLogging()
+	tlsConfig            = GetTLSConfig()
+	healthQuery          = GetHealthQuery()
+	timeouts             = GetTimeouts()
+	initOptions          vault.InitOptions
+	vaultClient          vault.Vault
+	keyStorage           secret.KeyStorage
+	keyDecrypter         *pgp.Decrypter
+	readKubernetesSecret = func(name string) (map[string][]byte, error) {
+		return secret.ReadKubernetesSecret(name, secret.CurrentNamespace())
+	}
+	createKubernetesStorage = func() (secret.KeyStorage, error) {
+		return secret.NewKubernetesSecretStorage(GetKubernetesSecretConfig())
+	}
+	createInMemoryStorage = func() secret.KeyStorage { return secret.NewMemorySecretStorage(log.Default()) }
+	createFileStorage     = func() (secret.KeyStorage, error) { return secret.NewFileSecretStorage(GetKeyFile()) }
+	createS3Storage       = func() (secret.KeyStorage, error) { return secret.NewS3Storage(GetS3StorageConfig()) }
+	getKeyEncrypter       = GetKeyEncrypter
 )
 
 func main() {
-	vaultClient = vault.NewVaultClient(address)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, err := vault.NewVaultClient(GetClientConfig(address))
+	if err != nil {
+		panic(err.Error())
+	}
+	vaultClient = client
+
+	options, err := GetInitOptions()
+	if err != nil {
+		panic(err.Error())
+	}
+	initOptions = options
+
+	decrypter, err := GetKeyDecrypter()
+	if err != nil {
+		panic(err.Error())
+	}
+	keyDecrypter = decrypter
 
 	storage, err := GetStorage()
 	if err != nil {
@@ -33,43 +80,265 @@ func main() {
 	}
 	keyStorage = storage
 
+	joinOptions, err := GetRaftJoinOptions()
+	if err != nil {
+		panic(err.Error())
+	}
+	raftJoinOptions = joinOptions
+
+	steps, err := GetBootstrapSteps()
+	if err != nil {
+		panic(err.Error())
+	}
+	bootstrapSteps = steps
+
+	manager, err := GetSnapshotManager()
+	if err != nil {
+		panic(err.Error())
+	}
+	snapshotManager = manager
+
+	if metricsAddress := os.Getenv("VAULT_METRICS_ADDR"); metricsAddress != "" {
+		go func() {
+			log.Printf("Metrics server stopped: %v", metrics.Serve(metricsAddress, metricsRegistry))
+		}()
+	}
+
+	if len(os.Args) > 1 {
+		if err := RunCommand(ctx, os.Args[1], os.Args[2:]); err != nil {
+			panic(err.Error())
+		}
+		return
+	}
+
+	clusterMode := IsClusterMode()
+	if err := ValidateRaftConfig(clusterMode); err != nil {
+		panic(err.Error())
+	}
 	for {
-		ok, err := run()
+		var ok bool
+		if clusterMode {
+			ok, err = runCluster(ctx)
+		} else {
+			ok, err = run(ctx)
+		}
+		if ctx.Err() != nil {
+			log.Println("Shutting down")
+			return
+		}
 		if !ok {
 			panic(err.Error())
 		}
-		time.Sleep(5 * time.Second)
+		sleep(ctx, 5*time.Second)
 	}
 }
 
-func run() (bool, error) {
-	vaultState := WaitForVault(func(d time.Duration) {
-		time.Sleep(d)
+func run(ctx context.Context) (bool, error) {
+	vaultState, err := WaitForVault(ctx, func(d time.Duration) {
+		sleep(ctx, d)
 	})
+	if err != nil {
+		return false, err
+	}
+	ok, err := ReconcileVault(ctx, GetNodeAddress(), vaultState)
+	if ok && IsUnsealed(vaultState) {
+		runMaintenance(ctx, vaultState)
+	}
+	return ok, err
+}
 
+// runMaintenance performs the periodic checks which need an unsealed Vault.
+// Standby nodes cannot take Raft snapshots, and rotating or bootstrapping from
+// every node would race, so those only run on the active node.
+func runMaintenance(ctx context.Context, vaultState vault.HealthState) {
+	if auditCheck {
+		CheckAuditDevices(ctx)
+	}
+	if vaultState.Active {
+		CheckKeyRotation(ctx)
+		CheckBootstrap(ctx)
+		CheckSnapshot(ctx)
+	}
+}
+
+// IsUnsealed reports whether Vault was serving requests when its health was checked
+func IsUnsealed(state vault.HealthState) bool {
+	return state.Active || state.Standby || state.PerformanceStandby
+}
+
+// sleep waits for the given duration, returning early if the context is cancelled
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// ReconcileVault initializes, joins or unseals the current Vault based on its health
+func ReconcileVault(ctx context.Context, nodeAddress string, vaultState vault.HealthState) (bool, error) {
 	if vaultState.Uninitialized {
-		state, err := InitializeVault()
+		join, err := ShouldJoinCluster(nodeAddress)
 		if err != nil {
 			return false, err
 		}
-		ok, err := SaveState(*state)
-		if !ok {
+		if join {
+			return JoinCluster(ctx, nodeAddress)
+		}
+	}
+
+	if vaultState.Uninitialized {
+		// Once Vault has generated new keys, keys left in the storage by a previous
+		// Vault would either be overwritten or block the new keys from being stored
+		hasKeys, err := HasStoredKeys()
+		if err != nil {
 			return false, err
 		}
-		ok, err = UnsealVaultFromState(*state)
+		if hasKeys {
+			return false, fmt.Errorf("Keys are already stored but Vault is not initialized, remove the stored keys to initialize a new Vault")
+		}
+
+		state, err := InitializeVault(ctx)
+		if errors.Is(err, vault.ErrAlreadyInitialized) {
+			// Another instance won the race, so treat Vault as sealed and use its stored keys
+			log.Println("Vault was initialized elsewhere, switching to unseal")
+			vaultState = vault.HealthState{Sealed: true}
+			return ReconcileVault(ctx, nodeAddress, vaultState)
+		}
+		if err != nil {
+			return false, err
+		}
+		stored := *state
+		if revokeRootToken {
+			// The root token only lives in memory until it is revoked
+			stored.RootToken = ""
+			stored.RootTokenFingerprint = ""
+		}
+		ok, err := SaveState(stored)
 		if !ok {
 			return false, err
 		}
+		if initOptions.AutoUnseal {
+			log.Println("Vault uses auto-unseal, skipping unseal")
+		} else if ok, err = UnsealVaultFromState(ctx, *state); !ok {
+			return false, err
+		}
+		return BootstrapVault(ctx, *state)
 	}
 
 	if vaultState.Sealed {
-		UnsealVault()
+		if initOptions.AutoUnseal {
+			// Migrating from Shamir still requires the stored unseal keys
+			status, err := vaultClient.SealStatus(ctx)
+			if err == nil && status.Migration {
+				return UnsealVault(ctx)
+			}
+			log.Println("Waiting for Vault to auto-unseal...")
+			return true, nil
+		}
+		return UnsealVault(ctx)
 	}
 
 	return true, nil
 }
 
+// GetStorage selects the key storage, encrypting the stored keys when VAULT_KEY_ENCRYPTION is set
 func GetStorage() (secret.KeyStorage, error) {
+	encrypter, err := getKeyEncrypter()
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(os.Getenv("VAULT_KEY_STORAGE"), "distributed") {
+		return GetDistributedStorage(encrypter)
+	}
+	storage, err := getKeyStorage()
+	if err != nil {
+		return nil, err
+	}
+	return encryptStorage(storage, encrypter), nil
+}
+
+// GetDistributedStorage splits the key shares across the backends listed in VAULT_KEY_BACKENDS,
+// e.g. "kubernetes:vault/vault-keys,file:/var/lib/vault-init/keys.json,s3:vault-keys/cluster-a"
+func GetDistributedStorage(encrypter secret.KeyEncrypter) (secret.KeyStorage, error) {
+	var backends []secret.KeyStorage
+	for _, spec := range getListEnv("VAULT_KEY_BACKENDS") {
+		backend, err := createStorageBackend(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key backend %q: %w", spec, err)
+		}
+		// Each backend is encrypted separately so that the shares it holds are
+		// unchanged when only the metadata is persisted
+		backends = append(backends, encryptStorage(backend, encrypter))
+	}
+	storage, err := secret.NewDistributedStorage(backends)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, threshold := initOptions.SecretShares, initOptions.SecretThreshold
+	if initOptions.AutoUnseal {
+		shares, threshold = initOptions.RecoveryShares, initOptions.RecoveryThreshold
+	}
+	if perBackend := storage.(*secret.DistributedStorage).MaxSharesPerBackend(shares); threshold > 0 && perBackend >= threshold {
+		return nil, fmt.Errorf("%d backends would each store up to %d of %d shares, reaching the threshold of %d", len(backends), perBackend, shares, threshold)
+	}
+	return storage, nil
+}
+
+// createStorageBackend creates one backend of the distributed storage from a "type:location" spec
+func createStorageBackend(spec string) (secret.KeyStorage, error) {
+	storageType, location, _ := strings.Cut(spec, ":")
+	switch strings.ToLower(storageType) {
+	case "kubernetes":
+		config := GetKubernetesSecretConfig()
+		namespace, name, found := strings.Cut(location, "/")
+		if !found {
+			namespace, name = "", location
+		}
+		config.Namespace, config.Name = namespace, name
+		return secret.NewKubernetesSecretStorage(config)
+	case "file":
+		if location == "" {
+			return nil, fmt.Errorf("No file path given")
+		}
+		return secret.NewFileSecretStorage(location)
+	case "s3":
+		config := GetS3StorageConfig()
+		bucket, prefix, _ := strings.Cut(location, "/")
+		config.Bucket, config.Prefix = bucket, prefix
+		return secret.NewS3Storage(config)
+	default:
+		return nil, fmt.Errorf("Unknown key storage %q", storageType)
+	}
+}
+
+// encryptStorage wraps the storage in encryption. Keys stored before encryption
+// was enabled are only accepted when VAULT_KEY_ENCRYPTION_ALLOW_PLAINTEXT is set.
+func encryptStorage(storage secret.KeyStorage, encrypter secret.KeyEncrypter) secret.KeyStorage {
+	if encrypter == nil {
+		return storage
+	}
+	allowPlaintext := strings.EqualFold(os.Getenv("VAULT_KEY_ENCRYPTION_ALLOW_PLAINTEXT"), "true")
+	return secret.NewEncryptedStorage(storage, encrypter, allowPlaintext)
+}
+
+// getKeyStorage selects the key storage named by VAULT_KEY_STORAGE, or when unset
+// uses a Kubernetes secret if running in-cluster and memory otherwise
+func getKeyStorage() (secret.KeyStorage, error) {
+	switch storageType := strings.ToLower(os.Getenv("VAULT_KEY_STORAGE")); storageType {
+	case "":
+	case "kubernetes":
+		return createKubernetesStorage()
+	case "file":
+		return createFileStorage()
+	case "s3":
+		return createS3Storage()
+	case "memory":
+		return createInMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("Unknown key storage %q", storageType)
+	}
+
 	kubeStorage, err := createKubernetesStorage()
 	if kubeStorage != nil {
 		return kubeStorage, nil
@@ -81,9 +350,13 @@ func GetStorage() (secret.KeyStorage, error) {
 	return nil, err
 }
 
-func WaitForVault(delay func(d time.Duration)) vault.HealthState {
+func WaitForVault(ctx context.Context, delay func(d time.Duration)) (vault.HealthState, error) {
 	for {
-		state, err := vaultClient.HealthCheck()
+		if err := ctx.Err(); err != nil {
+			return vault.HealthState{}, err
+		}
+
+		state, err := vaultClient.HealthCheck(ctx)
 		if err != nil {
 			log.Println(err)
 			delay(1 * time.Second)
@@ -91,28 +364,36 @@ func WaitForVault(delay func(d time.Duration)) vault.HealthState {
 		}
 
 		if debugLogging == true {
-			switch true {
-			case state.Active:
-				log.Println("Vault is initialized and unsealed.")
-			case state.Standby:
-				log.Println("Vault is unsealed and in standby mode.")
-			case state.Uninitialized:
-				log.Println("Vault is not initialized.")
-			case state.Sealed:
-				log.Println("Vault is sealed.")
-			default:
-				log.Printf("Vault is in an unknown state. Status code: %d", state.StatusCode)
-			}
+			log.Println(DescribeHealthState(state))
 		}
 
-		return state
+		return state, nil
+	}
+}
+
+func DescribeHealthState(state vault.HealthState) string {
+	switch true {
+	case state.Active:
+		return "Vault is initialized and unsealed."
+	case state.Standby:
+		return "Vault is unsealed and in standby mode."
+	case state.PerformanceStandby:
+		return "Vault is unsealed and in performance standby mode."
+	case state.DRSecondary:
+		return "Vault is a DR replication secondary."
+	case state.Uninitialized:
+		return "Vault is not initialized."
+	case state.Sealed:
+		return "Vault is sealed."
+	default:
+		return fmt.Sprintf("Vault is in an unknown state. Status code: %d", state.StatusCode)
 	}
 }
 
-func InitializeVault() (*vault.InitState, error) {
+func InitializeVault(ctx context.Context) (*vault.InitState, error) {
 	log.Println("Initialising Vault...")
 
-	state, err := vaultClient.Initialize()
+	state, err := vaultClient.Initialize(ctx, initOptions)
 	if err != nil {
 		return nil, fmt.Errorf("Initialization error: %w", err)
 	}
@@ -124,28 +405,163 @@ func SaveState(state vault.InitState) (bool, error) {
 	return keyStorage.Persist(state)
 }
 
-func UnsealVault() (bool, error) {
+func UnsealVault(ctx context.Context) (bool, error) {
 	state, err := keyStorage.Fetch()
 	if err != nil {
 		return false, fmt.Errorf("Failed to fetch keys: %w", err)
 	}
-	return UnsealVaultFromState(*state)
+	if len(state.BackupKeys) == 0 {
+		return UnsealVaultFromState(ctx, *state)
+	}
+
+	// A rekey has not been confirmed yet, so fall back to the previous keys if needed
+	ok, usedKeys, err := unsealVaultFromState(ctx, *state)
+	if ok {
+		// An already unsealed Vault says nothing about whether the new keys are valid
+		if usedKeys {
+			ConfirmRekey()
+		}
+		return ok, err
+	}
+	log.Printf("Unsealing with the rekeyed keys failed (%v), trying the backup keys", err)
+	return UnsealVaultFromState(ctx, vault.InitState{
+		Keys:            state.BackupKeys,
+		Threshold:       state.BackupThreshold,
+		KeyFingerprints: state.BackupKeyFingerprints,
+	})
+}
+
+func UnsealVaultFromState(ctx context.Context, state vault.InitState) (bool, error) {
+	ok, _, err := unsealVaultFromState(ctx, state)
+	return ok, err
 }
 
-func UnsealVaultFromState(state vault.InitState) (bool, error) {
+// unsealVaultFromState also reports whether the keys in the state unsealed Vault,
+// rather than Vault having been unsealed already
+func unsealVaultFromState(ctx context.Context, state vault.InitState) (bool, bool, error) {
+	keys, err := GetUnsealKeys(state)
+	if err != nil {
+		return false, false, err
+	}
+
+	status, err := vaultClient.SealStatus(ctx)
+	if err != nil {
+		return false, false, fmt.Errorf("Failed to read seal status: %w", err)
+	}
+	if !status.Sealed {
+		log.Println("Vault is already unsealed")
+		return true, false, nil
+	}
+
+	unseal := vaultClient.Unseal
+	if status.Migration {
+		log.Printf("Seal migration in progress (%v seal), submitting keys with migrate", status.Type)
+		unseal = vaultClient.UnsealMigrate
+		if len(state.Keys) == 0 {
+			// Migrating away from auto-unseal, the recovery keys unseal Vault
+			if keys, err = GetRecoveryKeys(state); err != nil {
+				return false, false, err
+			}
+		}
+	}
+	if len(keys) < status.Threshold {
+		return false, false, fmt.Errorf("Not enough unseal keys: %d available, %d required", len(keys), status.Threshold)
+	}
+
+	// Progress we did not make ourselves belongs to an abandoned or foreign unseal attempt
+	if status.Progress > 0 {
+		log.Printf("Resetting stale unseal progress [%d/%d] (nonce %v)", status.Progress, status.Threshold, status.Nonce)
+		if _, err := vaultClient.ResetUnseal(ctx); err != nil {
+			return false, false, fmt.Errorf("Failed to reset unseal progress: %w", err)
+		}
+	}
+
 	log.Println("Unsealing Vault...")
-	for index, key := range state.Keys {
-		event, err := vaultClient.Unseal(key)
+	failed := []int{}
+	var errs []error
+	for index, key := range keys {
+		// Stop once the remaining keys can no longer reach the threshold
+		if len(keys)-len(failed) < status.Threshold {
+			break
+		}
+		event, err := unseal(ctx, key)
+		if errors.Is(err, vault.ErrNotInitialized) {
+			return false, false, fmt.Errorf("Unseal aborted: %w", err)
+		}
+		// The remaining keys cannot be submitted once the context is cancelled or has expired
+		if ctx.Err() != nil {
+			return false, false, fmt.Errorf("Unseal aborted: %w", ctx.Err())
+		}
 		if err != nil {
-			log.Printf("Failed to unseal using key [%d]", index)
+			log.Printf("Failed to unseal using key [%d]: %v", index, err)
+			failed = append(failed, index)
+			errs = append(errs, err)
 			continue
 		}
 		log.Printf("Unseal progress: [%d/%d]", event.KeysProvided, event.KeysRequired)
+		if !event.Sealed && status.Migration {
+			ok, err := CompleteSealMigration(ctx)
+			return ok, true, err
+		}
 		if !event.Sealed {
-			return true, nil
+			return true, true, nil
 		}
 	}
-	return false, fmt.Errorf("Too many unseal failures")
+	return false, false, &UnsealError{Failed: failed, errs: errs}
+}
+
+// UnsealError reports the indexes of the keys which failed to unseal Vault,
+// and wraps the error returned for each of them
+type UnsealError struct {
+	Failed []int
+	errs   []error
+}
+
+func (err *UnsealError) Error() string {
+	return fmt.Sprintf("Too many unseal failures, failed keys: %v", err.Failed)
+}
+
+func (err *UnsealError) Unwrap() []error {
+	return err.errs
+}
+
+// GetUnsealKeys returns the plaintext unseal keys from the state, decrypting
+// the PGP encrypted shares for which a private key is available
+func GetUnsealKeys(state vault.InitState) ([]string, error) {
+	return decryptKeys("unseal", state.Keys, state.KeyFingerprints)
+}
+
+// GetRecoveryKeys returns the plaintext recovery keys of an auto-unseal Vault
+func GetRecoveryKeys(state vault.InitState) ([]string, error) {
+	return decryptKeys("recovery", state.RecoveryKeys, state.RecoveryKeyFingerprints)
+}
+
+func decryptKeys(kind string, encrypted []string, fingerprints []string) ([]string, error) {
+	if len(fingerprints) == 0 {
+		return encrypted, nil
+	}
+	if keyDecrypter == nil {
+		return nil, fmt.Errorf("The %v keys are PGP encrypted but no private key is configured", kind)
+	}
+
+	keys := []string{}
+	for index, key := range encrypted {
+		if index >= len(fingerprints) || !keyDecrypter.CanDecrypt(fingerprints[index]) {
+			continue
+		}
+		decrypted, err := keyDecrypter.Decrypt(key)
+		if err != nil {
+			log.Printf("Failed to decrypt key [%d]: %v", index, err)
+			continue
+		}
+		keys = append(keys, decrypted)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No %v keys could be decrypted with the configured private key", kind)
+	}
+	log.Printf("Decrypted %d of %d %v keys", len(keys), len(encrypted), kind)
+	return keys, nil
 }
 
 func GetVaultAddress() string {
@@ -157,7 +573,207 @@ func GetVaultAddress() string {
 	return DEFAULT_VAULT_ADDR
 }
 
+func GetClientConfig(nodeAddress string) vault.ClientConfig {
+	return vault.ClientConfig{
+		Address:     nodeAddress,
+		TLS:         tlsConfig,
+		HealthQuery: healthQuery,
+		Timeouts:    timeouts,
+	}
+}
+
+// GetTimeouts reads the timeouts applied to each Vault operation
+func GetTimeouts() vault.Timeouts {
+	return vault.Timeouts{
+		Default:    getDurationEnv("VAULT_CLIENT_TIMEOUT", DEFAULT_CLIENT_TIMEOUT),
+		Health:     getDurationEnv("VAULT_HEALTH_TIMEOUT", DEFAULT_HEALTH_TIMEOUT),
+		Initialize: getDurationEnv("VAULT_INIT_TIMEOUT", 0),
+		Unseal:     getDurationEnv("VAULT_UNSEAL_TIMEOUT", 0),
+		Snapshot:   getDurationEnv("VAULT_SNAPSHOT_TIMEOUT", 0),
+	}
+}
+
+// GetHealthQuery reads the query parameters sent to sys/health, e.g. "standbyok=true&perfstandbyok=true"
+func GetHealthQuery() url.Values {
+	value := os.Getenv("VAULT_HEALTH_QUERY")
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		log.Printf("VAULT_HEALTH_QUERY is not a valid query string (%q), ignoring", value)
+		return nil
+	}
+	return query
+}
+
+// GetTLSConfig reads the TLS settings using the same environment variables as the Vault CLI
+func GetTLSConfig() vault.TLSConfig {
+	skipVerify, _ := strconv.ParseBool(os.Getenv("VAULT_SKIP_VERIFY"))
+	if skipVerify {
+		log.Println("VAULT_SKIP_VERIFY is set, Vault's certificate will not be verified")
+	}
+
+	return vault.TLSConfig{
+		CACert:     os.Getenv("VAULT_CACERT"),
+		CAPath:     os.Getenv("VAULT_CAPATH"),
+		ClientCert: os.Getenv("VAULT_CLIENT_CERT"),
+		ClientKey:  os.Getenv("VAULT_CLIENT_KEY"),
+		ServerName: os.Getenv("VAULT_TLS_SERVER_NAME"),
+		Insecure:   skipVerify,
+	}
+}
+
 func GetDebugLogging() bool {
 	value := os.Getenv("DEBUG")
 	return strings.EqualFold(value, "true")
 }
+
+func GetInitOptions() (vault.InitOptions, error) {
+	options := vault.InitOptions{
+		SecretShares:    getIntEnv("VAULT_SECRET_SHARES", DEFAULT_SECRET_SHARES),
+		SecretThreshold: getIntEnv("VAULT_SECRET_THRESHOLD", DEFAULT_SECRET_THRESHOLD),
+		StoredShares:    getIntEnv("VAULT_STORED_SHARES", 0),
+	}
+
+	if strings.EqualFold(os.Getenv("VAULT_AUTO_UNSEAL"), "true") {
+		options.AutoUnseal = true
+		options.RecoveryShares = getIntEnv("VAULT_RECOVERY_SHARES", DEFAULT_SECRET_SHARES)
+		options.RecoveryThreshold = getIntEnv("VAULT_RECOVERY_THRESHOLD", DEFAULT_SECRET_THRESHOLD)
+	}
+
+	pgpKeys, err := GetPGPKeys()
+	if err != nil {
+		return vault.InitOptions{}, err
+	}
+	options.PGPKeys = pgpKeys
+
+	if path := os.Getenv("VAULT_ROOT_TOKEN_PGP_KEY_FILE"); path != "" {
+		keys, err := pgp.LoadKeyFiles([]string{path})
+		if err != nil {
+			return vault.InitOptions{}, err
+		}
+		options.RootTokenPGPKey = keys[0]
+	}
+
+	return options, nil
+}
+
+// GetPGPKeys loads the public keys used to encrypt the unseal keys, either from
+// a list of files or from the entries of a Kubernetes secret
+func GetPGPKeys() ([]string, error) {
+	if files := getListEnv("VAULT_PGP_KEY_FILES"); len(files) > 0 {
+		return pgp.LoadKeyFiles(files)
+	}
+	if secretName := os.Getenv("VAULT_PGP_KEYS_SECRET"); secretName != "" {
+		data, err := readKubernetesSecret(secretName)
+		if err != nil {
+			return nil, err
+		}
+		return pgp.LoadKeysFromSecretData(data)
+	}
+	return nil, nil
+}
+
+func GetKeyDecrypter() (*pgp.Decrypter, error) {
+	path := os.Getenv("VAULT_PGP_PRIVATE_KEY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read private key: %w", err)
+	}
+	return pgp.NewDecrypter(data, os.Getenv("VAULT_PGP_PRIVATE_KEY_PASSPHRASE"))
+}
+
+// GetKeyFile returns the path of the file used by the file key storage
+func GetKeyFile() string {
+	if path := os.Getenv("VAULT_KEY_FILE"); path != "" {
+		return path
+	}
+	return DEFAULT_KEY_FILE
+}
+
+// GetKubernetesSecretConfig reads the name, location and layout of the secret storing the keys
+func GetKubernetesSecretConfig() secret.KubernetesSecretConfig {
+	return secret.KubernetesSecretConfig{
+		Name:        os.Getenv("VAULT_KEYS_SECRET_NAME"),
+		Namespace:   os.Getenv("VAULT_KEYS_SECRET_NAMESPACE"),
+		Type:        v1.SecretType(os.Getenv("VAULT_KEYS_SECRET_TYPE")),
+		Labels:      getMapEnv("VAULT_KEYS_SECRET_LABELS"),
+		Annotations: getMapEnv("VAULT_KEYS_SECRET_ANNOTATIONS"),
+		DataKeys:    getMapEnv("VAULT_KEYS_SECRET_DATA_KEYS"),
+	}
+}
+
+// GetS3StorageConfig reads the bucket, object and encryption settings of the S3 key storage
+func GetS3StorageConfig() secret.S3StorageConfig {
+	// A raw 32 byte key can also be valid base64, so only a decoded key of the
+	// right length is taken to be base64 encoded
+	customerKey := []byte(os.Getenv("VAULT_KEYS_S3_SSE_CUSTOMER_KEY"))
+	if decoded, err := base64.StdEncoding.DecodeString(string(customerKey)); err == nil && len(decoded) == 32 {
+		customerKey = decoded
+	}
+	return secret.S3StorageConfig{
+		Endpoint:          os.Getenv("VAULT_KEYS_S3_ENDPOINT"),
+		Region:            os.Getenv("VAULT_KEYS_S3_REGION"),
+		Bucket:            os.Getenv("VAULT_KEYS_S3_BUCKET"),
+		Prefix:            os.Getenv("VAULT_KEYS_S3_PREFIX"),
+		Key:               os.Getenv("VAULT_KEYS_S3_KEY"),
+		AccessKeyID:       os.Getenv("VAULT_KEYS_S3_ACCESS_KEY_ID"),
+		SecretAccessKey:   os.Getenv("VAULT_KEYS_S3_SECRET_ACCESS_KEY"),
+		Insecure:          strings.EqualFold(os.Getenv("VAULT_KEYS_S3_INSECURE"), "true"),
+		SSE:               os.Getenv("VAULT_KEYS_S3_SSE"),
+		KMSKeyID:          os.Getenv("VAULT_KEYS_S3_SSE_KMS_KEY_ID"),
+		CustomerKey:       customerKey,
+		DeleteOldVersions: strings.EqualFold(os.Getenv("VAULT_KEYS_S3_DELETE_OLD_VERSIONS"), "true"),
+	}
+}
+
+func getDurationEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("%v is not a valid duration (%q), defaulting to %v", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getListEnv(name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getMapEnv parses a comma separated list of key=value pairs
+func getMapEnv(name string) map[string]string {
+	values := map[string]string{}
+	for _, entry := range getListEnv(name) {
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			log.Printf("%v entry %q is not of the form key=value, ignoring", name, entry)
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+func getIntEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("%v is not a valid integer (%q), defaulting to %d", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
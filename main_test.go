@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 	"github.com/mattgill98/vault-init/pkg/vault"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 type MockDelayFn struct {
@@ -48,16 +52,52 @@ func TestGetStorage_Kubernetes(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestGetStorage_Configured(t *testing.T) {
+	mockFileStorage := new(mocking.KeyStorageMock)
+	createFileStorage = func() (secret.KeyStorage, error) { return mockFileStorage, nil }
+	createKubernetesStorage = func() (secret.KeyStorage, error) { return nil, fmt.Errorf("Mock error") }
+	os.Setenv("VAULT_KEY_STORAGE", "file")
+	defer os.Unsetenv("VAULT_KEY_STORAGE")
+
+	storage, err := GetStorage()
+	assert.Equal(t, mockFileStorage, storage)
+	assert.Nil(t, err)
+
+	os.Setenv("VAULT_KEY_STORAGE", "floppy")
+	_, err = GetStorage()
+	assert.NotNil(t, err)
+}
+
+func TestGetStorage_Encrypted(t *testing.T) {
+	mockFileStorage := new(mocking.KeyStorageMock)
+	createFileStorage = func() (secret.KeyStorage, error) { return mockFileStorage, nil }
+	os.Setenv("VAULT_KEY_STORAGE", "file")
+	defer os.Unsetenv("VAULT_KEY_STORAGE")
+	key, _ := secret.GenerateKeyEncryptionKey()
+	os.Setenv("VAULT_KEY_ENCRYPTION", "env")
+	os.Setenv("VAULT_KEK", key)
+	defer os.Unsetenv("VAULT_KEY_ENCRYPTION")
+	defer os.Unsetenv("VAULT_KEK")
+
+	storage, err := GetStorage()
+	assert.Nil(t, err)
+	assert.IsType(t, &secret.EncryptedStorage{}, storage)
+
+	os.Unsetenv("VAULT_KEK")
+	_, err = GetStorage()
+	assert.NotNil(t, err)
+}
+
 func TestWaitForVault_VaultDown(t *testing.T) {
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
 	mockDelay := new(MockDelayFn)
 
 	mockDelay.On("func1", 1*time.Second).Once().Return()
-	mockVault.On("HealthCheck").Once().Return(vault.HealthState{}, fmt.Errorf("Failed to call vault"))
-	mockVault.On("HealthCheck").Once().Return(vault.HealthState{}, nil)
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{}, fmt.Errorf("Failed to call vault"))
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{}, nil)
 
-	WaitForVault(mockDelay.func1)
+	WaitForVault(context.Background(), mockDelay.func1)
 	mockDelay.AssertNumberOfCalls(t, "func1", 1)
 	mockVault.AssertNumberOfCalls(t, "HealthCheck", 2)
 }
@@ -66,46 +106,184 @@ func TestWaitForVault_VaultUp(t *testing.T) {
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
 
-	mockVault.On("HealthCheck").Once().Return(vault.HealthState{Active: true}, nil)
-	mockVault.On("HealthCheck").Once().Return(vault.HealthState{Standby: true}, nil)
-	mockVault.On("HealthCheck").Once().Return(vault.HealthState{Uninitialized: true}, nil)
-	mockVault.On("HealthCheck").Once().Return(vault.HealthState{Sealed: true}, nil)
-	mockVault.On("HealthCheck").Once().Return(vault.HealthState{StatusCode: 418}, nil)
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{Active: true}, nil)
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{Standby: true}, nil)
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{Uninitialized: true}, nil)
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{Sealed: true}, nil)
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{StatusCode: 418}, nil)
 
-	statusFn := func() vault.HealthState { return WaitForVault(func(d time.Duration) {}) }
+	statusFn := func() vault.HealthState {
+		state, _ := WaitForVault(context.Background(), func(d time.Duration) {})
+		return state
+	}
 	assert.Equal(t, vault.HealthState{Active: true}, statusFn())
 	assert.Equal(t, vault.HealthState{Standby: true}, statusFn())
 	assert.Equal(t, vault.HealthState{Uninitialized: true}, statusFn())
 	assert.Equal(t, vault.HealthState{Sealed: true}, statusFn())
 	assert.Equal(t, vault.HealthState{StatusCode: 418}, statusFn())
-	mockVault.AssertCalled(t, "HealthCheck")
+	mockVault.AssertCalled(t, "HealthCheck", mock.Anything)
+}
+
+func TestWaitForVault_Cancelled(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockVault.On("HealthCheck", mock.Anything).Run(mocking.WaitForCancellation).Return(vault.HealthState{}, context.Canceled)
+
+	go cancel()
+	_, err := WaitForVault(ctx, func(d time.Duration) {})
+	assert.ErrorIs(t, err, context.Canceled)
+	mockVault.AssertNumberOfCalls(t, "HealthCheck", 1)
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ok, err := run(ctx)
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, context.Canceled)
+	mockVault.AssertNotCalled(t, "HealthCheck", mock.Anything)
 }
 
 func TestInitializeVault_Success(t *testing.T) {
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
 
-	mockState := vault.InitState{Keys: []string{"a"}, RootToken: "b"}
-	mockVault.On("Initialize").Once().Return(mockState, nil)
+	mockState := vault.InitState{Keys: []string{"a"}, RootToken: "b", Threshold: 3}
+	mockVault.On("Initialize", mock.Anything, initOptions).Once().Return(mockState, nil)
 
-	state, err := InitializeVault()
+	state, err := InitializeVault(context.Background())
 	assert.Nil(t, err)
 	assert.Equal(t, mockState.Keys, state.Keys)
 	assert.Equal(t, mockState.RootToken, state.RootToken)
+	assert.Equal(t, mockState.Threshold, state.Threshold)
 
-	mockVault.AssertCalled(t, "Initialize")
+	mockVault.AssertCalled(t, "Initialize", mock.Anything, initOptions)
 }
 
 func TestInitializeVault_InitializationError(t *testing.T) {
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
-	mockVault.On("Initialize").Once().Return(vault.InitState{}, fmt.Errorf("Mock error"))
+	mockVault.On("Initialize", mock.Anything, initOptions).Once().Return(vault.InitState{}, fmt.Errorf("Mock error"))
 
-	state, err := InitializeVault()
+	state, err := InitializeVault(context.Background())
 	assert.Nil(t, state)
 	assert.Contains(t, err.Error(), "Mock error", "Initialization error")
 
-	mockVault.AssertCalled(t, "Initialize")
+	mockVault.AssertCalled(t, "Initialize", mock.Anything, initOptions)
+}
+
+func TestRun_AutoUnsealInitialization(t *testing.T) {
+	initOptions = vault.InitOptions{AutoUnseal: true, RecoveryShares: 3, RecoveryThreshold: 2}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockState := vault.InitState{RecoveryKeys: []string{"a", "b", "c"}, RecoveryThreshold: 2, RootToken: "root"}
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{Uninitialized: true}, nil)
+	mockVault.On("Initialize", mock.Anything, initOptions).Once().Return(mockState, nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Once().Return((*vault.InitState)(nil), secret.ErrKeysNotFound)
+	mockKeyStorage.On("Persist", mockState).Once().Return(true, nil)
+
+	ok, err := run(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertCalled(t, "Persist", mockState)
+	mockVault.AssertNotCalled(t, "Unseal", mock.Anything, mock.Anything)
+}
+
+func TestRun_AutoUnsealSealed(t *testing.T) {
+	initOptions = vault.InitOptions{AutoUnseal: true}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("HealthCheck", mock.Anything).Once().Return(vault.HealthState{Sealed: true}, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Type: "transit", Sealed: true}, nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+
+	ok, err := run(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertNotCalled(t, "Fetch")
+	mockVault.AssertNotCalled(t, "Unseal", mock.Anything, mock.Anything)
+}
+
+func TestReconcileVault_AlreadyInitialized(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	alreadyInitialized := &vault.APIError{StatusCode: 400, Errors: []string{"Vault is already initialized"}}
+	mockVault.On("Initialize", mock.Anything, initOptions).Once().Return(vault.InitState{}, alreadyInitialized)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Once().Return((*vault.InitState)(nil), secret.ErrKeysNotFound)
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}}, nil)
+
+	ok, err := ReconcileVault(context.Background(), address, vault.HealthState{Uninitialized: true})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertNotCalled(t, "Persist", mock.Anything)
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "a")
+}
+
+func TestReconcileVault_InitializesWithEncryptedKubernetesStorage(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockState := vault.InitState{Keys: []string{"a"}, Threshold: 1, RootToken: "root"}
+	mockVault.On("Initialize", mock.Anything, initOptions).Once().Return(mockState, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	// The storage creates an empty secret, which must not be mistaken for plaintext keys
+	kubernetes, err := secret.NewKubernetesSecretStorageForClient(fake.NewSimpleClientset(), secret.KubernetesSecretConfig{Namespace: "vault"})
+	assert.Nil(t, err)
+	key, _ := secret.GenerateKeyEncryptionKey()
+	encrypter, _ := secret.NewStaticKeyEncrypter([]byte(key))
+	keyStorage = encryptStorage(kubernetes, encrypter)
+
+	ok, err := ReconcileVault(context.Background(), address, vault.HealthState{Uninitialized: true})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	fetched, err := keyStorage.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, mockState, *fetched)
+}
+
+func TestUnsealVaultFromState_NotInitialized(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{}, &vault.APIError{StatusCode: 400, Errors: []string{"Vault is not initialized"}})
+
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b"}})
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, vault.ErrNotInitialized)
+	mockVault.AssertNumberOfCalls(t, "Unseal", 1)
+}
+
+func TestUnsealVaultFromState_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Run(func(mock.Arguments) { cancel() }).Return(vault.UnsealState{}, context.Canceled)
+
+	ok, err := UnsealVaultFromState(ctx, vault.InitState{Keys: []string{"a", "b", "c"}})
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, context.Canceled)
+	mockVault.AssertNumberOfCalls(t, "Unseal", 1)
 }
 
 func TestUnsealVault_FetchError(t *testing.T) {
@@ -113,7 +291,7 @@ func TestUnsealVault_FetchError(t *testing.T) {
 	keyStorage = mockKeyStorage
 	mockKeyStorage.On("Fetch").Return(&vault.InitState{}, fmt.Errorf("Mock error"))
 
-	ok, err := UnsealVault()
+	ok, err := UnsealVault(context.Background())
 	assert.False(t, ok)
 	assert.Contains(t, err.Error(), "Mock error", "Failed to fetch keys")
 }
@@ -126,10 +304,11 @@ func TestUnsealVault_Success(t *testing.T) {
 
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
-	mockVault.On("Unseal", mock.Anything).Times(2).Return(vault.UnsealState{Sealed: true}, nil)
-	mockVault.On("Unseal", mock.Anything).Once().Return(vault.UnsealState{Sealed: false}, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 3}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Times(2).Return(vault.UnsealState{Sealed: true}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Once().Return(vault.UnsealState{Sealed: false}, nil)
 
-	ok, err := UnsealVault()
+	ok, err := UnsealVault(context.Background())
 	assert.True(t, ok)
 	assert.Nil(t, err)
 	mockVault.AssertNumberOfCalls(t, "Unseal", 3)
@@ -138,47 +317,108 @@ func TestUnsealVault_Success(t *testing.T) {
 func TestUnsealVaultFromState_TooManyFailures(t *testing.T) {
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
-	mockVault.On("Unseal", mock.Anything).Times(2).Return(vault.UnsealState{Sealed: true}, nil)
-	mockVault.On("Unseal", mock.Anything).Once().Return(vault.UnsealState{Sealed: false}, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 3}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Times(2).Return(vault.UnsealState{Sealed: true}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Once().Return(vault.UnsealState{Sealed: false}, nil)
 
-	ok, err := UnsealVaultFromState(vault.InitState{Keys: []string{"a", "b", "c"}})
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b", "c"}})
 	assert.True(t, ok)
 	assert.Nil(t, err)
 	mockVault.AssertNumberOfCalls(t, "Unseal", 3)
-	mockVault.AssertCalled(t, "Unseal", "a")
-	mockVault.AssertCalled(t, "Unseal", "b")
-	mockVault.AssertCalled(t, "Unseal", "c")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "a")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "b")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "c")
 }
 
 func TestUnsealVaultFromState_SingleError(t *testing.T) {
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
-	mockVault.On("Unseal", mock.Anything).Once().Return(vault.UnsealState{Sealed: true}, nil)
-	mockVault.On("Unseal", mock.Anything).Once().Return(vault.UnsealState{}, fmt.Errorf("Mock error"))
-	mockVault.On("Unseal", mock.Anything).Once().Return(vault.UnsealState{Sealed: false}, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 2}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Once().Return(vault.UnsealState{Sealed: true}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Once().Return(vault.UnsealState{}, fmt.Errorf("Mock error"))
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Once().Return(vault.UnsealState{Sealed: false}, nil)
 
-	ok, err := UnsealVaultFromState(vault.InitState{Keys: []string{"a", "b", "c"}})
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b", "c"}})
 	assert.True(t, ok)
 	assert.Nil(t, err)
 	mockVault.AssertNumberOfCalls(t, "Unseal", 3)
-	mockVault.AssertCalled(t, "Unseal", "a")
-	mockVault.AssertCalled(t, "Unseal", "b")
-	mockVault.AssertCalled(t, "Unseal", "c")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "a")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "b")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "c")
 }
 
 func TestUnsealVaultFromState_MultipleErrors(t *testing.T) {
 	mockVault := new(mocking.VaultMock)
 	vaultClient = mockVault
-	mockVault.On("Unseal", mock.Anything).Once().Return(vault.UnsealState{Sealed: true}, nil)
-	mockVault.On("Unseal", mock.Anything).Times(2).Return(vault.UnsealState{}, fmt.Errorf("Mock error"))
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 2}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Once().Return(vault.UnsealState{Sealed: true}, nil)
+	mockVault.On("Unseal", mock.Anything, mock.Anything).Times(2).Return(vault.UnsealState{}, fmt.Errorf("Mock error"))
 
-	ok, err := UnsealVaultFromState(vault.InitState{Keys: []string{"a", "b", "c"}})
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b", "c"}})
 	assert.False(t, ok)
-	assert.Equal(t, "Too many unseal failures", err.Error())
+	assert.Equal(t, "Too many unseal failures, failed keys: [1 2]", err.Error())
 	mockVault.AssertNumberOfCalls(t, "Unseal", 3)
-	mockVault.AssertCalled(t, "Unseal", "a")
-	mockVault.AssertCalled(t, "Unseal", "b")
-	mockVault.AssertCalled(t, "Unseal", "c")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "a")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "b")
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "c")
+}
+
+func TestUnsealVaultFromState_AlreadyUnsealed(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: false, Threshold: 2}, nil)
+
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b", "c"}})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockVault.AssertNotCalled(t, "Unseal", mock.Anything, mock.Anything)
+}
+
+func TestUnsealVaultFromState_ResetsStaleProgress(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 2, Progress: 1, Nonce: "foreign"}, nil)
+	mockVault.On("ResetUnseal", mock.Anything).Once().Return(vault.UnsealState{Sealed: true}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: true}, nil)
+	mockVault.On("Unseal", mock.Anything, "b").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b", "c"}})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockVault.AssertCalled(t, "ResetUnseal", mock.Anything)
+	mockVault.AssertNotCalled(t, "Unseal", mock.Anything, "c")
+}
+
+func TestUnsealVaultFromState_StopsWhenThresholdUnreachable(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 3}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{}, fmt.Errorf("Mock error"))
+
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b", "c"}})
+	assert.False(t, ok)
+	assert.Equal(t, "Too many unseal failures, failed keys: [0]", err.Error())
+	mockVault.AssertNumberOfCalls(t, "Unseal", 1)
+}
+
+func TestUnsealVaultFromState_NotEnoughKeys(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 3}, nil)
+
+	ok, err := UnsealVaultFromState(context.Background(), vault.InitState{Keys: []string{"a", "b"}})
+	assert.False(t, ok)
+	assert.Contains(t, err.Error(), "Not enough unseal keys")
+	mockVault.AssertNotCalled(t, "Unseal", mock.Anything, mock.Anything)
+}
+
+func TestGetTimeouts(t *testing.T) {
+	os.Setenv("VAULT_CLIENT_TIMEOUT", "30s")
+	os.Setenv("VAULT_UNSEAL_TIMEOUT", "invalid")
+	defer os.Unsetenv("VAULT_CLIENT_TIMEOUT")
+	defer os.Unsetenv("VAULT_UNSEAL_TIMEOUT")
+
+	assert.Equal(t, vault.Timeouts{Default: 30 * time.Second, Health: DEFAULT_HEALTH_TIMEOUT}, GetTimeouts())
 }
 
 func TestGetVaultAddress_EmptyString(t *testing.T) {
@@ -191,3 +431,108 @@ func TestGetVaultAddress_ValidString(t *testing.T) {
 	os.Setenv("VAULT_ADDR", vaultAddr)
 	assert.Equal(t, vaultAddr, GetVaultAddress(), "Expected the default vault address")
 }
+
+func TestGetInitOptions_Defaults(t *testing.T) {
+	os.Setenv("VAULT_SECRET_SHARES", "")
+	os.Setenv("VAULT_SECRET_THRESHOLD", "")
+	os.Setenv("VAULT_STORED_SHARES", "")
+	options, err := GetInitOptions()
+	assert.Nil(t, err)
+	assert.Equal(t, vault.InitOptions{SecretShares: 5, SecretThreshold: 3}, options)
+}
+
+func TestGetInitOptions_Configured(t *testing.T) {
+	os.Setenv("VAULT_SECRET_SHARES", "7")
+	os.Setenv("VAULT_SECRET_THRESHOLD", "4")
+	os.Setenv("VAULT_STORED_SHARES", "invalid")
+	defer os.Unsetenv("VAULT_SECRET_SHARES")
+	defer os.Unsetenv("VAULT_SECRET_THRESHOLD")
+	defer os.Unsetenv("VAULT_STORED_SHARES")
+	options, err := GetInitOptions()
+	assert.Nil(t, err)
+	assert.Equal(t, vault.InitOptions{SecretShares: 7, SecretThreshold: 4}, options)
+}
+
+func TestGetPGPKeys_SecretError(t *testing.T) {
+	os.Setenv("VAULT_PGP_KEYS_SECRET", "pgp-keys")
+	defer os.Unsetenv("VAULT_PGP_KEYS_SECRET")
+	readKubernetesSecret = func(name string) (map[string][]byte, error) {
+		assert.Equal(t, "pgp-keys", name)
+		return nil, fmt.Errorf("Mock error")
+	}
+
+	keys, err := GetPGPKeys()
+	assert.Nil(t, keys)
+	assert.Equal(t, "Mock error", err.Error())
+}
+
+func TestGetUnsealKeys_Plaintext(t *testing.T) {
+	keys, err := GetUnsealKeys(vault.InitState{Keys: []string{"a", "b"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+}
+
+func TestGetUnsealKeys_NoPrivateKey(t *testing.T) {
+	keyDecrypter = nil
+	keys, err := GetUnsealKeys(vault.InitState{Keys: []string{"a"}, KeyFingerprints: []string{"f"}})
+	assert.Nil(t, keys)
+	assert.Contains(t, err.Error(), "no private key is configured")
+}
+
+func TestGetKubernetesSecretConfig(t *testing.T) {
+	os.Setenv("VAULT_KEYS_SECRET_NAMESPACE", "vault")
+	os.Setenv("VAULT_KEYS_SECRET_LABELS", "app=vault, team=platform,invalid")
+	defer os.Unsetenv("VAULT_KEYS_SECRET_NAMESPACE")
+	defer os.Unsetenv("VAULT_KEYS_SECRET_LABELS")
+
+	config := GetKubernetesSecretConfig()
+	assert.Equal(t, "", config.Name)
+	assert.Equal(t, "vault", config.Namespace)
+	assert.Equal(t, map[string]string{"app": "vault", "team": "platform"}, config.Labels)
+	assert.Equal(t, map[string]string{}, config.DataKeys)
+}
+
+func TestGetDistributedStorage(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("VAULT_KEY_BACKENDS", fmt.Sprintf("file:%v/a.json,file:%v/b.json", dir, dir))
+	defer os.Unsetenv("VAULT_KEY_BACKENDS")
+	initOptions = vault.InitOptions{SecretShares: 5, SecretThreshold: 3}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	// Two backends would each hold three of the five shares
+	_, err := GetDistributedStorage(nil)
+	assert.NotNil(t, err)
+
+	os.Setenv("VAULT_KEY_BACKENDS", fmt.Sprintf("file:%v/a.json,file:%v/b.json,file:%v/c.json", dir, dir, dir))
+	storage, err := GetDistributedStorage(nil)
+	assert.Nil(t, err)
+	assert.IsType(t, &secret.DistributedStorage{}, storage)
+
+	os.Setenv("VAULT_KEY_BACKENDS", "floppy:a,file:b")
+	_, err = GetDistributedStorage(nil)
+	assert.NotNil(t, err)
+}
+
+func TestGetStorage_S3(t *testing.T) {
+	mockS3Storage := new(mocking.KeyStorageMock)
+	createS3Storage = func() (secret.KeyStorage, error) { return mockS3Storage, nil }
+	os.Setenv("VAULT_KEY_STORAGE", "s3")
+	defer os.Unsetenv("VAULT_KEY_STORAGE")
+
+	storage, err := GetStorage()
+	assert.Equal(t, mockS3Storage, storage)
+	assert.Nil(t, err)
+}
+
+func TestGetS3StorageConfig_CustomerKey(t *testing.T) {
+	defer os.Unsetenv("VAULT_KEYS_S3_SSE_CUSTOMER_KEY")
+
+	key := strings.Repeat("k", 32)
+	os.Setenv("VAULT_KEYS_S3_SSE_CUSTOMER_KEY", base64.StdEncoding.EncodeToString([]byte(key)))
+	assert.Equal(t, []byte(key), GetS3StorageConfig().CustomerKey)
+
+	// Also valid base64, but only decodes to 24 bytes
+	raw := strings.Repeat("abcd", 8)
+	os.Setenv("VAULT_KEYS_S3_SSE_CUSTOMER_KEY", raw)
+	assert.Equal(t, []byte(raw), GetS3StorageConfig().CustomerKey)
+}
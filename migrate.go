@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// CompleteSealMigration converts the stored keys once Vault has been unsealed with
+// the migrate flag. Moving to an auto-unseal the unseal keys become recovery keys,
+// and moving back to Shamir the recovery keys become unseal keys.
+func CompleteSealMigration(ctx context.Context) (bool, error) {
+	status, err := vaultClient.SealStatus(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Failed to read seal status after migration: %w", err)
+	}
+	stored, err := keyStorage.Fetch()
+	if err != nil {
+		return false, fmt.Errorf("Failed to fetch keys: %w", err)
+	}
+	state := *stored
+
+	switch {
+	case status.RecoverySeal && len(state.Keys) > 0:
+		log.Printf("Seal migrated to %v, storing the unseal keys as recovery keys", status.Type)
+		state.RecoveryKeys = state.Keys
+		state.RecoveryThreshold = state.Threshold
+		state.RecoveryKeyFingerprints = state.KeyFingerprints
+		state.Keys = nil
+		state.Threshold = 0
+		state.KeyFingerprints = nil
+	case !status.RecoverySeal && len(state.Keys) == 0 && len(state.RecoveryKeys) > 0:
+		log.Printf("Seal migrated to %v, storing the recovery keys as unseal keys", status.Type)
+		state.Keys = state.RecoveryKeys
+		state.Threshold = state.RecoveryThreshold
+		state.KeyFingerprints = state.RecoveryKeyFingerprints
+		state.RecoveryKeys = nil
+		state.RecoveryThreshold = 0
+		state.RecoveryKeyFingerprints = nil
+	default:
+		return true, nil
+	}
+
+	// The migrated keys unsealed Vault, so any backup from a rekey is obsolete
+	state.BackupKeys = nil
+	state.BackupThreshold = 0
+	state.BackupKeyFingerprints = nil
+
+	RecordAuditEvent("seal-migration", map[string]string{"seal": status.Type})
+	return SaveState(state)
+}
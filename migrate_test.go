@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReconcileVault_MigratesToAutoUnseal(t *testing.T) {
+	initOptions = vault.InitOptions{AutoUnseal: true}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	state := vault.InitState{Keys: []string{"a", "b"}, Threshold: 2, RootToken: "root"}
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&state, nil)
+	migrated := vault.InitState{RecoveryKeys: []string{"a", "b"}, RecoveryThreshold: 2, RootToken: "root"}
+	mockKeyStorage.On("Persist", migrated).Once().Return(true, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Twice().Return(vault.SealState{Type: "shamir", Sealed: true, Threshold: 2, Migration: true}, nil)
+	mockVault.On("SealStatus", mock.Anything).Once().Return(vault.SealState{Type: "transit", RecoverySeal: true}, nil)
+	mockVault.On("UnsealMigrate", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: true, KeysProvided: 1, KeysRequired: 2}, nil)
+	mockVault.On("UnsealMigrate", mock.Anything, "b").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	ok, err := ReconcileVault(context.Background(), address, vault.HealthState{Sealed: true})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertCalled(t, "Persist", migrated)
+	mockVault.AssertNotCalled(t, "Unseal", mock.Anything, mock.Anything)
+}
+
+func TestUnsealVaultFromState_MigratesToShamir(t *testing.T) {
+	state := vault.InitState{RecoveryKeys: []string{"a"}, RecoveryThreshold: 1}
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&state, nil)
+	migrated := vault.InitState{Keys: []string{"a"}, Threshold: 1}
+	mockKeyStorage.On("Persist", migrated).Once().Return(true, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Once().Return(vault.SealState{Type: "transit", Sealed: true, Threshold: 1, Migration: true, RecoverySeal: true}, nil)
+	mockVault.On("SealStatus", mock.Anything).Once().Return(vault.SealState{Type: "shamir"}, nil)
+	mockVault.On("UnsealMigrate", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	ok, err := UnsealVaultFromState(context.Background(), state)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertCalled(t, "Persist", migrated)
+}
@@ -0,0 +1,67 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+// AuditDevice is an audit log destination, e.g. {type: file, options: {file_path: /vault/audit/audit.log}}
+type AuditDevice struct {
+	Path        string            `json:"path"`
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Local       bool              `json:"local,omitempty"`
+	Options     map[string]string `json:"options,omitempty"`
+}
+
+func applyAuditDevices(ctx context.Context, client vault.Vault, token string, devices []AuditDevice) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	existing, err := client.Read(ctx, token, "sys/audit")
+	if err != nil {
+		return fmt.Errorf("Failed to list audit devices: %w", err)
+	}
+
+	for _, device := range devices {
+		path := normalizePath(device.Path)
+		if path == "" {
+			path = device.Type
+		}
+
+		// Audit devices cannot be tuned, so existing devices are left as they are
+		deviceType, found := existingType(existing, path)
+		if found && deviceType != device.Type {
+			return fmt.Errorf("Audit device %v already exists with type %v, expected %v", path, deviceType, device.Type)
+		}
+		if found {
+			continue
+		}
+
+		log.Printf("Enabling %v audit device at %v", device.Type, path)
+		request := map[string]interface{}{
+			"type":        device.Type,
+			"description": device.Description,
+			"local":       device.Local,
+		}
+		if len(device.Options) > 0 {
+			request["options"] = device.Options
+		}
+		if _, err := client.Write(ctx, token, "sys/audit/"+path, request); err != nil {
+			return fmt.Errorf("Failed to enable audit device %v: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// CountAuditDevices returns the number of enabled audit devices
+func CountAuditDevices(ctx context.Context, client vault.Vault, token string) (int, error) {
+	existing, err := client.Read(ctx, token, "sys/audit")
+	if err != nil {
+		return 0, fmt.Errorf("Failed to list audit devices: %w", err)
+	}
+	return len(existing), nil
+}
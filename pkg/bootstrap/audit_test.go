@@ -0,0 +1,37 @@
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestApplyAuditDevices(t *testing.T) {
+	client := new(mocking.VaultMock)
+	client.On("Read", mock.Anything, "root", "sys/audit").Return(map[string]interface{}{
+		"file/": map[string]interface{}{"type": "file"},
+	}, nil)
+	client.On("Write", mock.Anything, "root", mock.Anything, mock.Anything).Return(nil, nil)
+
+	err := applyAuditDevices(context.Background(), client, "root", []AuditDevice{
+		{Type: "file", Options: map[string]string{"file_path": "/vault/audit/audit.log"}},
+		{Path: "syslog", Type: "syslog", Local: true},
+	})
+	assert.Nil(t, err)
+	client.AssertNotCalled(t, "Write", mock.Anything, "root", "sys/audit/file", mock.Anything)
+	client.AssertCalled(t, "Write", mock.Anything, "root", "sys/audit/syslog", map[string]interface{}{
+		"type": "syslog", "description": "", "local": true,
+	})
+}
+
+func TestCountAuditDevices(t *testing.T) {
+	client := new(mocking.VaultMock)
+	client.On("Read", mock.Anything, "root", "sys/audit").Return(map[string]interface{}{}, nil)
+
+	count, err := CountAuditDevices(context.Background(), client, "root")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
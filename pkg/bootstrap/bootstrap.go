@@ -0,0 +1,198 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"sigs.k8s.io/yaml"
+)
+
+// Config describes the desired configuration of a Vault, applied with the root token
+type Config struct {
+	Audit    []AuditDevice `json:"audit"`
+	Mounts   []Mount       `json:"mounts"`
+	Auth     []AuthMethod  `json:"auth"`
+	Policies []Policy      `json:"policies"`
+	Roles    []Role        `json:"roles"`
+
+	KubernetesAuth *KubernetesAuth `json:"kubernetes_auth,omitempty"`
+}
+
+// Mount is a secrets engine, e.g. {path: secret, type: kv, options: {version: "2"}}
+type Mount struct {
+	Path        string                 `json:"path"`
+	Type        string                 `json:"type"`
+	Description string                 `json:"description,omitempty"`
+	Options     map[string]string      `json:"options,omitempty"`
+	Config      map[string]interface{} `json:"config,omitempty"`
+}
+
+// AuthMethod is an auth method, e.g. {path: kubernetes, type: kubernetes}
+type AuthMethod struct {
+	Path        string                 `json:"path"`
+	Type        string                 `json:"type"`
+	Description string                 `json:"description,omitempty"`
+	Config      map[string]interface{} `json:"config,omitempty"`
+}
+
+// Policy is an ACL policy written in HCL
+type Policy struct {
+	Name   string `json:"name"`
+	Policy string `json:"policy"`
+}
+
+// Role is written as-is to its path, e.g. auth/kubernetes/role/app
+type Role struct {
+	Path string                 `json:"path"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Load reads a YAML (or JSON) bootstrap file
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("Failed to read bootstrap file: %w", err)
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, fmt.Errorf("Invalid bootstrap file %v: %w", path, err)
+	}
+	return config, nil
+}
+
+// Apply reconciles Vault with the configuration. Existing mounts and auth methods
+// are tuned rather than re-enabled, so that it can be applied repeatedly.
+func Apply(ctx context.Context, client vault.Vault, token string, config Config) error {
+	// Audit devices come first so that the remaining requests are logged
+	if err := applyAuditDevices(ctx, client, token, config.Audit); err != nil {
+		return err
+	}
+	if err := applyMounts(ctx, client, token, config.Mounts); err != nil {
+		return err
+	}
+	if err := applyAuthMethods(ctx, client, token, config.Auth); err != nil {
+		return err
+	}
+	for _, policy := range config.Policies {
+		log.Printf("Writing policy %v", policy.Name)
+		if _, err := client.Write(ctx, token, "sys/policies/acl/"+policy.Name, map[string]interface{}{"policy": policy.Policy}); err != nil {
+			return fmt.Errorf("Failed to write policy %v: %w", policy.Name, err)
+		}
+	}
+	if config.KubernetesAuth != nil {
+		if err := applyKubernetesAuth(ctx, client, token, *config.KubernetesAuth); err != nil {
+			return err
+		}
+	}
+	for _, role := range config.Roles {
+		log.Printf("Writing role %v", role.Path)
+		if _, err := client.Write(ctx, token, role.Path, role.Data); err != nil {
+			return fmt.Errorf("Failed to write role %v: %w", role.Path, err)
+		}
+	}
+	return nil
+}
+
+func applyMounts(ctx context.Context, client vault.Vault, token string, mounts []Mount) error {
+	existing, err := client.Read(ctx, token, "sys/mounts")
+	if err != nil {
+		return fmt.Errorf("Failed to list mounts: %w", err)
+	}
+
+	for _, mount := range mounts {
+		path := normalizePath(mount.Path)
+		tune := map[string]interface{}{}
+		if mount.Description != "" {
+			tune["description"] = mount.Description
+		}
+		if len(mount.Options) > 0 {
+			tune["options"] = mount.Options
+		}
+		for key, value := range mount.Config {
+			tune[key] = value
+		}
+
+		mountType, found := existingType(existing, path)
+		if !found {
+			log.Printf("Enabling %v secrets engine at %v", mount.Type, path)
+			request := map[string]interface{}{"type": mount.Type, "description": mount.Description}
+			if len(mount.Options) > 0 {
+				request["options"] = mount.Options
+			}
+			if len(mount.Config) > 0 {
+				request["config"] = mount.Config
+			}
+			if _, err := client.Write(ctx, token, "sys/mounts/"+path, request); err != nil {
+				return fmt.Errorf("Failed to enable mount %v: %w", path, err)
+			}
+			continue
+		}
+		if mountType != mount.Type {
+			return fmt.Errorf("Mount %v already exists with type %v, expected %v", path, mountType, mount.Type)
+		}
+		if len(tune) > 0 {
+			if _, err := client.Write(ctx, token, "sys/mounts/"+path+"/tune", tune); err != nil {
+				return fmt.Errorf("Failed to tune mount %v: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func applyAuthMethods(ctx context.Context, client vault.Vault, token string, methods []AuthMethod) error {
+	existing, err := client.Read(ctx, token, "sys/auth")
+	if err != nil {
+		return fmt.Errorf("Failed to list auth methods: %w", err)
+	}
+
+	for _, method := range methods {
+		path := normalizePath(method.Path)
+		methodType, found := existingType(existing, path)
+		if !found {
+			log.Printf("Enabling %v auth method at %v", method.Type, path)
+			request := map[string]interface{}{"type": method.Type, "description": method.Description}
+			if len(method.Config) > 0 {
+				request["config"] = method.Config
+			}
+			if _, err := client.Write(ctx, token, "sys/auth/"+path, request); err != nil {
+				return fmt.Errorf("Failed to enable auth method %v: %w", path, err)
+			}
+			continue
+		}
+		if methodType != method.Type {
+			return fmt.Errorf("Auth method %v already exists with type %v, expected %v", path, methodType, method.Type)
+		}
+
+		tune := map[string]interface{}{}
+		if method.Description != "" {
+			tune["description"] = method.Description
+		}
+		for key, value := range method.Config {
+			tune[key] = value
+		}
+		if len(tune) > 0 {
+			if _, err := client.Write(ctx, token, "sys/auth/"+path+"/tune", tune); err != nil {
+				return fmt.Errorf("Failed to tune auth method %v: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// existingType looks up a mount in a sys/mounts or sys/auth listing, which are keyed by path with a trailing slash
+func existingType(existing map[string]interface{}, path string) (string, bool) {
+	entry, ok := existing[path+"/"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	mountType, _ := entry["type"].(string)
+	return mountType, true
+}
+
+func normalizePath(path string) string {
+	return strings.Trim(path, "/")
+}
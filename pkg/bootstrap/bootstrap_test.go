@@ -0,0 +1,106 @@
+package bootstrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const exampleConfig = `
+mounts:
+  - path: secret
+    type: kv
+    options:
+      version: "2"
+auth:
+  - path: kubernetes
+    type: kubernetes
+policies:
+  - name: reader
+    policy: |
+      path "secret/data/*" { capabilities = ["read"] }
+roles:
+  - path: auth/kubernetes/role/app
+    data:
+      bound_service_account_names: [app]
+      bound_service_account_namespaces: [default]
+      policies: [reader]
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bootstrap.yaml")
+	os.WriteFile(path, []byte(exampleConfig), 0600)
+
+	config, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, Mount{Path: "secret", Type: "kv", Options: map[string]string{"version": "2"}}, config.Mounts[0])
+	assert.Equal(t, "kubernetes", config.Auth[0].Type)
+	assert.Equal(t, "reader", config.Policies[0].Name)
+	assert.Equal(t, []interface{}{"reader"}, config.Roles[0].Data["policies"])
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bootstrap.yaml")
+	os.WriteFile(path, []byte("mount: []\n"), 0600)
+
+	_, err := Load(path)
+	assert.NotNil(t, err)
+}
+
+func TestApply_EnablesMissing(t *testing.T) {
+	client := new(mocking.VaultMock)
+	client.On("Read", mock.Anything, "root", "sys/mounts").Return(map[string]interface{}{}, nil)
+	client.On("Read", mock.Anything, "root", "sys/auth").Return(map[string]interface{}{}, nil)
+	client.On("Write", mock.Anything, "root", mock.Anything, mock.Anything).Return(nil, nil)
+
+	err := Apply(context.Background(), client, "root", Config{
+		Mounts: []Mount{{Path: "/secret/", Type: "kv", Options: map[string]string{"version": "2"}}},
+		Auth:   []AuthMethod{{Path: "kubernetes", Type: "kubernetes"}},
+	})
+	assert.Nil(t, err)
+	client.AssertCalled(t, "Write", mock.Anything, "root", "sys/mounts/secret", map[string]interface{}{
+		"type": "kv", "description": "", "options": map[string]string{"version": "2"},
+	})
+	client.AssertCalled(t, "Write", mock.Anything, "root", "sys/auth/kubernetes", map[string]interface{}{
+		"type": "kubernetes", "description": "",
+	})
+}
+
+func TestApply_TunesExisting(t *testing.T) {
+	client := new(mocking.VaultMock)
+	client.On("Read", mock.Anything, "root", "sys/mounts").Return(map[string]interface{}{
+		"secret/": map[string]interface{}{"type": "kv"},
+	}, nil)
+	client.On("Read", mock.Anything, "root", "sys/auth").Return(map[string]interface{}{
+		"kubernetes/": map[string]interface{}{"type": "kubernetes"},
+	}, nil)
+	client.On("Write", mock.Anything, "root", mock.Anything, mock.Anything).Return(nil, nil)
+
+	err := Apply(context.Background(), client, "root", Config{
+		Mounts: []Mount{{Path: "secret", Type: "kv", Options: map[string]string{"version": "2"}}},
+		Auth:   []AuthMethod{{Path: "kubernetes", Type: "kubernetes"}},
+	})
+	assert.Nil(t, err)
+	client.AssertCalled(t, "Write", mock.Anything, "root", "sys/mounts/secret/tune", map[string]interface{}{
+		"options": map[string]string{"version": "2"},
+	})
+	client.AssertNotCalled(t, "Write", mock.Anything, "root", "sys/mounts/secret", mock.Anything)
+	client.AssertNotCalled(t, "Write", mock.Anything, "root", "sys/auth/kubernetes", mock.Anything)
+}
+
+func TestApply_TypeConflict(t *testing.T) {
+	client := new(mocking.VaultMock)
+	client.On("Read", mock.Anything, "root", "sys/mounts").Return(map[string]interface{}{
+		"secret/": map[string]interface{}{"type": "generic"},
+	}, nil)
+
+	err := Apply(context.Background(), client, "root", Config{
+		Mounts: []Mount{{Path: "secret", Type: "kv"}},
+	})
+	assert.Contains(t, err.Error(), "already exists with type generic")
+}
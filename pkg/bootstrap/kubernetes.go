@@ -0,0 +1,85 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	DEFAULT_KUBERNETES_AUTH_PATH = "kubernetes"
+)
+
+// KubernetesAuth enables the kubernetes auth method, configured with the API server
+// and CA bundle of the cluster vault-init is running in
+type KubernetesAuth struct {
+	Path  string           `json:"path,omitempty"`
+	Roles []KubernetesRole `json:"roles,omitempty"`
+}
+
+// KubernetesRole binds service accounts to policies
+type KubernetesRole struct {
+	Name            string   `json:"name"`
+	ServiceAccounts []string `json:"service_accounts"`
+	Namespaces      []string `json:"namespaces"`
+	Policies        []string `json:"policies,omitempty"`
+	TTL             string   `json:"ttl,omitempty"`
+	Audience        string   `json:"audience,omitempty"`
+}
+
+var (
+	inClusterConfig = rest.InClusterConfig
+)
+
+func applyKubernetesAuth(ctx context.Context, client vault.Vault, token string, auth KubernetesAuth) error {
+	config, err := inClusterConfig()
+	if err != nil {
+		return fmt.Errorf("Kubernetes auth requires running in-cluster: %w", err)
+	}
+	caCert := config.TLSClientConfig.CAData
+	if len(caCert) == 0 && config.TLSClientConfig.CAFile != "" {
+		caCert, err = os.ReadFile(config.TLSClientConfig.CAFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read the Kubernetes CA certificate: %w", err)
+		}
+	}
+
+	path := normalizePath(auth.Path)
+	if path == "" {
+		path = DEFAULT_KUBERNETES_AUTH_PATH
+	}
+	if err := applyAuthMethods(ctx, client, token, []AuthMethod{{Path: path, Type: "kubernetes"}}); err != nil {
+		return err
+	}
+
+	log.Printf("Configuring kubernetes auth at %v for %v", path, config.Host)
+	if _, err := client.Write(ctx, token, "auth/"+path+"/config", map[string]interface{}{
+		"kubernetes_host":    config.Host,
+		"kubernetes_ca_cert": string(caCert),
+	}); err != nil {
+		return fmt.Errorf("Failed to configure kubernetes auth: %w", err)
+	}
+
+	for _, role := range auth.Roles {
+		data := map[string]interface{}{
+			"bound_service_account_names":      role.ServiceAccounts,
+			"bound_service_account_namespaces": role.Namespaces,
+			"token_policies":                   role.Policies,
+		}
+		if role.TTL != "" {
+			data["token_ttl"] = role.TTL
+		}
+		if role.Audience != "" {
+			data["audience"] = role.Audience
+		}
+		log.Printf("Writing kubernetes auth role %v", role.Name)
+		if _, err := client.Write(ctx, token, "auth/"+path+"/role/"+role.Name, data); err != nil {
+			return fmt.Errorf("Failed to write kubernetes auth role %v: %w", role.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/client-go/rest"
+)
+
+func TestApplyKubernetesAuth(t *testing.T) {
+	inClusterConfig = func() (*rest.Config, error) {
+		return &rest.Config{Host: "https://10.0.0.1:443", TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca")}}, nil
+	}
+	defer func() { inClusterConfig = rest.InClusterConfig }()
+
+	client := new(mocking.VaultMock)
+	client.On("Read", mock.Anything, "root", "sys/auth").Return(map[string]interface{}{}, nil)
+	client.On("Write", mock.Anything, "root", mock.Anything, mock.Anything).Return(nil, nil)
+
+	err := applyKubernetesAuth(context.Background(), client, "root", KubernetesAuth{
+		Roles: []KubernetesRole{{Name: "app", ServiceAccounts: []string{"app"}, Namespaces: []string{"default"}, Policies: []string{"reader"}, TTL: "1h"}},
+	})
+	assert.Nil(t, err)
+	client.AssertCalled(t, "Write", mock.Anything, "root", "sys/auth/kubernetes", map[string]interface{}{"type": "kubernetes", "description": ""})
+	client.AssertCalled(t, "Write", mock.Anything, "root", "auth/kubernetes/config", map[string]interface{}{
+		"kubernetes_host":    "https://10.0.0.1:443",
+		"kubernetes_ca_cert": "ca",
+	})
+	client.AssertCalled(t, "Write", mock.Anything, "root", "auth/kubernetes/role/app", map[string]interface{}{
+		"bound_service_account_names":      []string{"app"},
+		"bound_service_account_namespaces": []string{"default"},
+		"token_policies":                   []string{"reader"},
+		"token_ttl":                        "1h",
+	})
+}
+
+func TestApplyKubernetesAuth_NotInCluster(t *testing.T) {
+	inClusterConfig = func() (*rest.Config, error) { return nil, rest.ErrNotInCluster }
+	defer func() { inClusterConfig = rest.InClusterConfig }()
+
+	err := applyKubernetesAuth(context.Background(), new(mocking.VaultMock), "root", KubernetesAuth{})
+	assert.ErrorIs(t, err, rest.ErrNotInCluster)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+type metric struct {
+	help       string
+	metricType string
+	value      float64
+}
+
+// Registry holds a set of unlabelled metrics and serves them in the Prometheus text format
+type Registry struct {
+	lock    sync.Mutex
+	metrics map[string]*metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]*metric{}}
+}
+
+// Set updates the value of a gauge
+func (registry *Registry) Set(name string, help string, value float64) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.get(name, help, TypeGauge).value = value
+}
+
+// Add increments a counter
+func (registry *Registry) Add(name string, help string, delta float64) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.get(name, help, TypeCounter).value += delta
+}
+
+// Value returns the current value of a metric, or 0 if it has not been recorded
+func (registry *Registry) Value(name string) float64 {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if m, ok := registry.metrics[name]; ok {
+		return m.value
+	}
+	return 0
+}
+
+func (registry *Registry) get(name string, help string, metricType string) *metric {
+	m, ok := registry.metrics[name]
+	if !ok {
+		m = &metric{help: help, metricType: metricType}
+		registry.metrics[name] = m
+	}
+	return m
+}
+
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	names := []string{}
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range names {
+		m := registry.metrics[name]
+		fmt.Fprintf(w, "# HELP %v %v\n", name, m.help)
+		fmt.Fprintf(w, "# TYPE %v %v\n", name, m.metricType)
+		fmt.Fprintf(w, "%v %v\n", name, m.value)
+	}
+}
+
+// Serve exposes the registry on /metrics at the given address
+func Serve(address string, registry *Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	return http.ListenAndServe(address, mux)
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("b_gauge", "A gauge", 1.5)
+	registry.Add("a_total", "A counter", 1)
+	registry.Add("a_total", "A counter", 2)
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, `# HELP a_total A counter
+# TYPE a_total counter
+a_total 3
+# HELP b_gauge A gauge
+# TYPE b_gauge gauge
+b_gauge 1.5
+`, recorder.Body.String())
+}
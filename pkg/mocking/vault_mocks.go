@@ -1,6 +1,9 @@
 package mocking
 
 import (
+	"context"
+	"io"
+
 	"github.com/mattgill98/vault-init/pkg/vault"
 	"github.com/stretchr/testify/mock"
 )
@@ -9,15 +12,94 @@ type VaultMock struct {
 	mock.Mock
 }
 
-func (m *VaultMock) HealthCheck() (vault.HealthState, error) {
-	args := m.Called()
+// WaitForCancellation can be passed to Run to block a mocked call until its context is cancelled
+func WaitForCancellation(args mock.Arguments) {
+	<-args.Get(0).(context.Context).Done()
+}
+
+func (m *VaultMock) HealthCheck(ctx context.Context) (vault.HealthState, error) {
+	args := m.Called(ctx)
 	return args.Get(0).(vault.HealthState), args.Error(1)
 }
-func (m *VaultMock) Initialize() (vault.InitState, error) {
-	args := m.Called()
+func (m *VaultMock) Initialize(ctx context.Context, options vault.InitOptions) (vault.InitState, error) {
+	args := m.Called(ctx, options)
 	return args.Get(0).(vault.InitState), args.Error(1)
 }
-func (m *VaultMock) Unseal(key string) (vault.UnsealState, error) {
-	args := m.Called(key)
+func (m *VaultMock) Unseal(ctx context.Context, key string) (vault.UnsealState, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(vault.UnsealState), args.Error(1)
+}
+func (m *VaultMock) UnsealMigrate(ctx context.Context, key string) (vault.UnsealState, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(vault.UnsealState), args.Error(1)
+}
+func (m *VaultMock) ResetUnseal(ctx context.Context) (vault.UnsealState, error) {
+	args := m.Called(ctx)
 	return args.Get(0).(vault.UnsealState), args.Error(1)
 }
+func (m *VaultMock) SealStatus(ctx context.Context) (vault.SealState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(vault.SealState), args.Error(1)
+}
+func (m *VaultMock) RaftJoin(ctx context.Context, options vault.RaftJoinOptions) (bool, error) {
+	args := m.Called(ctx, options)
+	return args.Bool(0), args.Error(1)
+}
+func (m *VaultMock) RekeyInit(ctx context.Context, options vault.InitOptions) (vault.RekeyState, error) {
+	args := m.Called(ctx, options)
+	return args.Get(0).(vault.RekeyState), args.Error(1)
+}
+func (m *VaultMock) RekeyUpdate(ctx context.Context, key string, nonce string) (vault.RekeyState, error) {
+	args := m.Called(ctx, key, nonce)
+	return args.Get(0).(vault.RekeyState), args.Error(1)
+}
+func (m *VaultMock) RekeyVerify(ctx context.Context, key string, nonce string) (vault.RekeyState, error) {
+	args := m.Called(ctx, key, nonce)
+	return args.Get(0).(vault.RekeyState), args.Error(1)
+}
+func (m *VaultMock) RekeyCancel(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+func (m *VaultMock) GenerateRootInit(ctx context.Context) (vault.GenerateRootState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(vault.GenerateRootState), args.Error(1)
+}
+func (m *VaultMock) GenerateRootUpdate(ctx context.Context, key string, nonce string) (vault.GenerateRootState, error) {
+	args := m.Called(ctx, key, nonce)
+	return args.Get(0).(vault.GenerateRootState), args.Error(1)
+}
+func (m *VaultMock) GenerateRootCancel(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+func (m *VaultMock) RevokeSelf(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+func (m *VaultMock) KeyStatus(ctx context.Context, token string) (vault.KeyState, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(vault.KeyState), args.Error(1)
+}
+func (m *VaultMock) Rotate(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+func (m *VaultMock) Snapshot(ctx context.Context, token string, w io.Writer) error {
+	args := m.Called(ctx, token, w)
+	return args.Error(0)
+}
+func (m *VaultMock) RestoreSnapshot(ctx context.Context, token string, r io.Reader, force bool) error {
+	args := m.Called(ctx, token, r, force)
+	return args.Error(0)
+}
+func (m *VaultMock) Read(ctx context.Context, token string, path string) (map[string]interface{}, error) {
+	args := m.Called(ctx, token, path)
+	data, _ := args.Get(0).(map[string]interface{})
+	return data, args.Error(1)
+}
+func (m *VaultMock) Write(ctx context.Context, token string, path string, data map[string]interface{}) (map[string]interface{}, error) {
+	args := m.Called(ctx, token, path, data)
+	response, _ := args.Get(0).(map[string]interface{})
+	return response, args.Error(1)
+}
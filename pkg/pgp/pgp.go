@@ -0,0 +1,167 @@
+package pgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+var (
+	ErrNoMatchingKey = errors.New("No private key available for recipient")
+)
+
+// EncodeKey converts an armored, binary or base64 encoded public key into the
+// base64 encoded binary form expected by the Vault API
+func EncodeKey(data []byte) (string, error) {
+	var keyBytes []byte
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		block, err := armor.Decode(bytes.NewReader(trimmed))
+		if err != nil {
+			return "", fmt.Errorf("Failed to decode armored key: %w", err)
+		}
+		keyBytes, err = io.ReadAll(block.Body)
+		if err != nil {
+			return "", fmt.Errorf("Failed to decode armored key: %w", err)
+		}
+	} else if decoded, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil {
+		keyBytes = decoded
+	} else {
+		keyBytes = data
+	}
+
+	if _, err := openpgp.ReadKeyRing(bytes.NewReader(keyBytes)); err != nil {
+		return "", fmt.Errorf("Invalid public key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(keyBytes), nil
+}
+
+// LoadKeyFiles reads and encodes the public key stored in each of the given files
+func LoadKeyFiles(paths []string) ([]string, error) {
+	keys := []string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read public key: %w", err)
+		}
+		key, err := EncodeKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// LoadKeysFromSecretData encodes the public keys stored in a Kubernetes secret,
+// ordered by their data key so that the share order is stable
+func LoadKeysFromSecretData(data map[string][]byte) ([]string, error) {
+	names := []string{}
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := []string{}
+	for _, name := range names {
+		key, err := EncodeKey(data[name])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Fingerprint returns the hex encoded fingerprint of the primary key in an encoded public key
+func Fingerprint(encodedKey string) (string, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return "", fmt.Errorf("Invalid public key encoding: %w", err)
+	}
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(keyBytes))
+	if err != nil {
+		return "", fmt.Errorf("Invalid public key: %w", err)
+	}
+	return hex.EncodeToString(entities[0].PrimaryKey.Fingerprint[:]), nil
+}
+
+type Decrypter struct {
+	keyring openpgp.EntityList
+}
+
+// NewDecrypter loads an armored or binary private keyring, unlocking it with the passphrase if one is provided
+func NewDecrypter(data []byte, passphrase string) (*Decrypter, error) {
+	var keyring openpgp.EntityList
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid private key: %w", err)
+	}
+
+	if passphrase != "" {
+		for _, entity := range keyring {
+			if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+				if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+					return nil, fmt.Errorf("Failed to unlock private key: %w", err)
+				}
+			}
+			for _, subkey := range entity.Subkeys {
+				if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+					if err := subkey.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+						return nil, fmt.Errorf("Failed to unlock private key: %w", err)
+					}
+				}
+			}
+		}
+	}
+
+	return &Decrypter{keyring: keyring}, nil
+}
+
+// CanDecrypt reports whether the keyring holds the private key for the given recipient fingerprint
+func (decrypter *Decrypter) CanDecrypt(fingerprint string) bool {
+	for _, entity := range decrypter.keyring {
+		if entity.PrivateKey != nil && strings.EqualFold(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]), fingerprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Decrypt decodes a base64 encoded message produced by Vault and returns the plaintext
+func (decrypter *Decrypter) Decrypt(encrypted string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("Invalid encrypted value: %w", err)
+	}
+
+	message, err := openpgp.ReadMessage(bytes.NewReader(ciphertext), decrypter.keyring, nil, nil)
+	if err != nil {
+		if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+			return "", ErrNoMatchingKey
+		}
+		return "", fmt.Errorf("Failed to decrypt value: %w", err)
+	}
+
+	plaintext, err := io.ReadAll(message.UnverifiedBody)
+	if err != nil {
+		return "", fmt.Errorf("Failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,104 @@
+package pgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEntity(t *testing.T, name string) *openpgp.Entity {
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	assert.Nil(t, err)
+	return entity
+}
+
+func armoredPublicKey(t *testing.T, entity *openpgp.Entity) []byte {
+	var buffer bytes.Buffer
+	writer, err := armor.Encode(&buffer, openpgp.PublicKeyType, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, entity.Serialize(writer))
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func armoredPrivateKey(t *testing.T, entity *openpgp.Entity) []byte {
+	var buffer bytes.Buffer
+	writer, err := armor.Encode(&buffer, openpgp.PrivateKeyType, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, entity.SerializePrivate(writer, nil))
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func encrypt(t *testing.T, entity *openpgp.Entity, plaintext string) string {
+	// Generated entities carry no hash preferences, so advertise SHA256 as GnuPG would
+	for _, identity := range entity.Identities {
+		identity.SelfSignature.PreferredHash = []uint8{8}
+	}
+
+	var buffer bytes.Buffer
+	writer, err := openpgp.Encrypt(&buffer, []*openpgp.Entity{entity}, nil, nil, nil)
+	assert.Nil(t, err)
+	writer.Write([]byte(plaintext))
+	writer.Close()
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+func TestEncodeKey_Formats(t *testing.T) {
+	entity := newEntity(t, "alice")
+	armored := armoredPublicKey(t, entity)
+
+	encoded, err := EncodeKey(armored)
+	assert.Nil(t, err)
+
+	reencoded, err := EncodeKey([]byte(encoded))
+	assert.Nil(t, err)
+	assert.Equal(t, encoded, reencoded)
+
+	binary, _ := base64.StdEncoding.DecodeString(encoded)
+	fromBinary, err := EncodeKey(binary)
+	assert.Nil(t, err)
+	assert.Equal(t, encoded, fromBinary)
+
+	_, err = EncodeKey([]byte("not a key"))
+	assert.NotNil(t, err)
+}
+
+func TestLoadKeysFromSecretData_Ordered(t *testing.T) {
+	alice := newEntity(t, "alice")
+	bob := newEntity(t, "bob")
+
+	keys, err := LoadKeysFromSecretData(map[string][]byte{
+		"2-bob":   armoredPublicKey(t, bob),
+		"1-alice": armoredPublicKey(t, alice),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+
+	fingerprint, err := Fingerprint(keys[0])
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(alice.PrimaryKey.Fingerprint[:]), fingerprint)
+}
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	alice := newEntity(t, "alice")
+	bob := newEntity(t, "bob")
+
+	decrypter, err := NewDecrypter(armoredPrivateKey(t, alice), "")
+	assert.Nil(t, err)
+
+	assert.True(t, decrypter.CanDecrypt(hex.EncodeToString(alice.PrimaryKey.Fingerprint[:])))
+	assert.False(t, decrypter.CanDecrypt(hex.EncodeToString(bob.PrimaryKey.Fingerprint[:])))
+
+	plaintext, err := decrypter.Decrypt(encrypt(t, alice, "abcdef"))
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", plaintext)
+
+	_, err = decrypter.Decrypt(encrypt(t, bob, "abcdef"))
+	assert.ErrorIs(t, err, ErrNoMatchingKey)
+}
@@ -0,0 +1,261 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+var (
+	ErrInsufficientShares = errors.New("Not enough key shares available")
+)
+
+// DistributedStorage spreads the key shares across several independent backends,
+// so that no single backend holds enough shares to reach the threshold. Share i
+// is stored by backend i modulo the number of backends, and every backend holds
+// the thresholds and fingerprints needed to use its shares. Each Persist tags the
+// parts with a new generation, so that shares from a partially written Persist are
+// never mixed with the shares they replaced.
+type DistributedStorage struct {
+	backends []KeyStorage
+
+	// The shares held by each backend when last fetched, nil if it was unavailable or stale
+	fetched    []*vault.InitState
+	generation int64
+}
+
+func NewDistributedStorage(backends []KeyStorage) (KeyStorage, error) {
+	if len(backends) < 2 {
+		return nil, fmt.Errorf("Distributed key storage requires at least 2 backends, found %d", len(backends))
+	}
+	return &DistributedStorage{backends: backends}, nil
+}
+
+// MaxSharesPerBackend returns the most shares any one backend stores when splitting the given number of shares
+func (distributed *DistributedStorage) MaxSharesPerBackend(shares int) int {
+	return (shares + len(distributed.backends) - 1) / len(distributed.backends)
+}
+
+func (distributed *DistributedStorage) Persist(state vault.InitState) (bool, error) {
+	if state.RootToken != "" && state.RootTokenFingerprint == "" {
+		// A plaintext root token in any backend would bypass the split entirely
+		log.Println("Distributed key storage does not store the root token unless it is encrypted with PGP")
+		state.RootToken = ""
+	}
+	for _, shares := range []struct {
+		keys      []string
+		threshold int
+	}{{state.Keys, state.Threshold}, {state.RecoveryKeys, state.RecoveryThreshold}} {
+		if shares.threshold > 0 && distributed.MaxSharesPerBackend(len(shares.keys)) >= shares.threshold {
+			log.Printf("Warning: a single key backend holds %d shares, enough to reach the threshold of %d", distributed.MaxSharesPerBackend(len(shares.keys)), shares.threshold)
+		}
+	}
+
+	parts := distributed.split(state)
+	generation := time.Now().UnixNano()
+	if distributed.unchanged(state) {
+		// Only the metadata changed since the shares were fetched, so keep each backend's
+		// shares in place rather than redistributing the shares which could be read
+		parts = distributed.fetched
+		generation = distributed.generation
+	}
+	state.Generation = generation
+
+	var errs []error
+	for index, backend := range distributed.backends {
+		if parts[index] == nil {
+			log.Printf("Key backend %d was unavailable when the keys were read, leaving it unchanged", index)
+			continue
+		}
+		part := withShares(state, *parts[index])
+		if ok, err := backend.Persist(part); !ok {
+			errs = append(errs, fmt.Errorf("Key backend %d: %w", index, err))
+		}
+	}
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+	distributed.fetched = parts
+	distributed.generation = generation
+	return true, nil
+}
+
+// Fetch reads every backend, skipping those which are unavailable, and merges the
+// parts of the newest generation whose shares reach the threshold. All backends are
+// read so that a later Persist does not drop the shares of backends read after the threshold.
+func (distributed *DistributedStorage) Fetch() (*vault.InitState, error) {
+	fetched := make([]*vault.InitState, len(distributed.backends))
+	generations := []int64{}
+	seen := map[int64]bool{}
+	available, empty := 0, 0
+	for index, backend := range distributed.backends {
+		part, err := backend.Fetch()
+		if errors.Is(err, ErrKeysNotFound) {
+			empty++
+			continue
+		}
+		if err != nil {
+			log.Printf("Key backend %d is unavailable: %v", index, err)
+			continue
+		}
+		fetched[index] = part
+		available++
+		if !seen[part.Generation] {
+			seen[part.Generation] = true
+			generations = append(generations, part.Generation)
+		}
+	}
+	if empty == len(distributed.backends) {
+		return nil, ErrKeysNotFound
+	}
+	if available == 0 {
+		return nil, fmt.Errorf("%w: no key backends are available", ErrInsufficientShares)
+	}
+
+	sort.Slice(generations, func(i, j int) bool { return generations[i] > generations[j] })
+	var errs []error
+	for _, generation := range generations {
+		var merged vault.InitState
+		for _, part := range fetched {
+			if part != nil && part.Generation == generation {
+				merged = mergeShares(merged, *part)
+			}
+		}
+		if err := checkShares(merged); err != nil {
+			log.Printf("Key generation %d is incomplete: %v", generation, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		// Parts of other generations hold shares which cannot be combined with these
+		for index, part := range fetched {
+			if part != nil && part.Generation != generation {
+				log.Printf("Key backend %d holds shares from an older or incomplete write, ignoring them", index)
+				fetched[index] = nil
+			}
+		}
+		distributed.fetched = fetched
+		distributed.generation = generation
+		merged.Generation = 0
+		return &merged, nil
+	}
+	return nil, errs[0]
+}
+
+func checkShares(state vault.InitState) error {
+	if len(state.Keys) < state.Threshold {
+		return fmt.Errorf("%w: found %d of %d unseal keys", ErrInsufficientShares, len(state.Keys), state.Threshold)
+	}
+	if len(state.RecoveryKeys) < state.RecoveryThreshold {
+		return fmt.Errorf("%w: found %d of %d recovery keys", ErrInsufficientShares, len(state.RecoveryKeys), state.RecoveryThreshold)
+	}
+	return nil
+}
+
+// split assigns each share of the state to a backend
+func (distributed *DistributedStorage) split(state vault.InitState) []*vault.InitState {
+	parts := make([]*vault.InitState, len(distributed.backends))
+	for index := range parts {
+		parts[index] = &vault.InitState{}
+	}
+	for index, key := range state.Keys {
+		part := parts[index%len(parts)]
+		part.Keys = append(part.Keys, key)
+		part.KeyFingerprints = appendFingerprint(part.KeyFingerprints, state.KeyFingerprints, index)
+	}
+	for index, key := range state.RecoveryKeys {
+		part := parts[index%len(parts)]
+		part.RecoveryKeys = append(part.RecoveryKeys, key)
+		part.RecoveryKeyFingerprints = appendFingerprint(part.RecoveryKeyFingerprints, state.RecoveryKeyFingerprints, index)
+	}
+	for index, key := range state.BackupKeys {
+		part := parts[index%len(parts)]
+		part.BackupKeys = append(part.BackupKeys, key)
+		part.BackupKeyFingerprints = appendFingerprint(part.BackupKeyFingerprints, state.BackupKeyFingerprints, index)
+	}
+	return parts
+}
+
+// unchanged reports whether the state holds exactly the shares last fetched
+func (distributed *DistributedStorage) unchanged(state vault.InitState) bool {
+	if distributed.fetched == nil {
+		return false
+	}
+	var merged vault.InitState
+	for _, part := range distributed.fetched {
+		if part != nil {
+			merged = mergeShares(merged, *part)
+		}
+	}
+	return sameValues(merged.Keys, state.Keys) &&
+		sameValues(merged.RecoveryKeys, state.RecoveryKeys) &&
+		sameValues(merged.BackupKeys, state.BackupKeys)
+}
+
+// withShares copies the metadata of the state onto the shares held by one backend
+func withShares(state vault.InitState, shares vault.InitState) vault.InitState {
+	state.Keys = shares.Keys
+	state.KeyFingerprints = shares.KeyFingerprints
+	state.RecoveryKeys = shares.RecoveryKeys
+	state.RecoveryKeyFingerprints = shares.RecoveryKeyFingerprints
+	state.BackupKeys = shares.BackupKeys
+	state.BackupKeyFingerprints = shares.BackupKeyFingerprints
+	return state
+}
+
+func mergeShares(merged vault.InitState, part vault.InitState) vault.InitState {
+	merged.Keys = append(merged.Keys, part.Keys...)
+	merged.KeyFingerprints = append(merged.KeyFingerprints, part.KeyFingerprints...)
+	merged.RecoveryKeys = append(merged.RecoveryKeys, part.RecoveryKeys...)
+	merged.RecoveryKeyFingerprints = append(merged.RecoveryKeyFingerprints, part.RecoveryKeyFingerprints...)
+	merged.BackupKeys = append(merged.BackupKeys, part.BackupKeys...)
+	merged.BackupKeyFingerprints = append(merged.BackupKeyFingerprints, part.BackupKeyFingerprints...)
+
+	merged.Threshold = maxInt(merged.Threshold, part.Threshold)
+	merged.RecoveryThreshold = maxInt(merged.RecoveryThreshold, part.RecoveryThreshold)
+	merged.BackupThreshold = maxInt(merged.BackupThreshold, part.BackupThreshold)
+	merged.RootTokenRevoked = merged.RootTokenRevoked || part.RootTokenRevoked
+	if merged.RootToken == "" {
+		merged.RootToken = part.RootToken
+		merged.RootTokenFingerprint = part.RootTokenFingerprint
+	}
+	if merged.EncryptedDataKey == "" {
+		merged.EncryptedDataKey = part.EncryptedDataKey
+	}
+	return merged
+}
+
+func appendFingerprint(fingerprints []string, all []string, index int) []string {
+	if index < len(all) {
+		return append(fingerprints, all[index])
+	}
+	return fingerprints
+}
+
+func sameValues(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, value := range a {
+		counts[value]++
+	}
+	for _, value := range b {
+		if counts[value] == 0 {
+			return false
+		}
+		counts[value]--
+	}
+	return true
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,101 @@
+package secret
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newFileBackends(t *testing.T, count int) []KeyStorage {
+	dir := t.TempDir()
+	backends := []KeyStorage{}
+	for index := 0; index < count; index++ {
+		backend, err := NewFileSecretStorage(filepath.Join(dir, fmt.Sprintf("keys-%d.json", index)))
+		assert.Nil(t, err)
+		backends = append(backends, backend)
+	}
+	return backends
+}
+
+func TestDistributedStorage_PersistAndFetch(t *testing.T) {
+	backends := newFileBackends(t, 3)
+	storage, err := NewDistributedStorage(backends)
+	assert.Nil(t, err)
+
+	state := vault.InitState{Keys: []string{"a", "b", "c", "d", "e"}, KeyFingerprints: []string{"1", "2", "3", "4", "5"}, Threshold: 3, RootToken: "root"}
+	ok, err := storage.Persist(state)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	first, _ := backends[0].Fetch()
+	assert.Equal(t, []string{"a", "d"}, first.Keys)
+	assert.Equal(t, []string{"1", "4"}, first.KeyFingerprints)
+	assert.Equal(t, 3, first.Threshold)
+	assert.Empty(t, first.RootToken)
+
+	fetched, err := storage.Fetch()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, state.Keys, fetched.Keys)
+	assert.Equal(t, 3, fetched.Threshold)
+	assert.Empty(t, fetched.RootToken)
+}
+
+func TestDistributedStorage_UnavailableBackend(t *testing.T) {
+	unavailable := new(mocking.KeyStorageMock)
+	backends := append(newFileBackends(t, 2), unavailable)
+	storage, _ := NewDistributedStorage(backends)
+
+	unavailable.On("Persist", mock.Anything).Return(true, nil)
+	storage.Persist(vault.InitState{Keys: []string{"a", "b", "c"}, Threshold: 2})
+
+	unavailable.On("Fetch").Return((*vault.InitState)(nil), fmt.Errorf("Mock error"))
+	fetched, err := storage.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, fetched.Keys)
+
+	// Persisting the same shares keeps them in place and skips the unavailable backend
+	fetched.RootTokenRevoked = true
+	ok, err := storage.Persist(*fetched)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	unavailable.AssertNumberOfCalls(t, "Persist", 1)
+	second, _ := backends[1].Fetch()
+	assert.Equal(t, []string{"b"}, second.Keys)
+	assert.True(t, second.RootTokenRevoked)
+}
+
+func TestDistributedStorage_IgnoresPartialWrite(t *testing.T) {
+	backends := newFileBackends(t, 3)
+	storage, _ := NewDistributedStorage(backends)
+	storage.Persist(vault.InitState{Keys: []string{"a", "b", "c"}, Threshold: 2})
+
+	// A later write which only reached the first backend
+	stored, _ := backends[0].Fetch()
+	backends[0].Persist(vault.InitState{Keys: []string{"x"}, Threshold: 2, Generation: stored.Generation + 1})
+
+	fetched, err := storage.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c"}, fetched.Keys)
+	assert.Zero(t, fetched.Generation)
+}
+
+func TestDistributedStorage_InsufficientShares(t *testing.T) {
+	unavailable := new(mocking.KeyStorageMock)
+	unavailable.On("Persist", mock.Anything).Return(true, nil)
+	unavailable.On("Fetch").Return((*vault.InitState)(nil), fmt.Errorf("Mock error"))
+	storage, _ := NewDistributedStorage(append(newFileBackends(t, 1), unavailable))
+	storage.Persist(vault.InitState{Keys: []string{"a", "b"}, Threshold: 2})
+
+	_, err := storage.Fetch()
+	assert.ErrorIs(t, err, ErrInsufficientShares)
+}
+
+func TestDistributedStorage_TooFewBackends(t *testing.T) {
+	_, err := NewDistributedStorage(newFileBackends(t, 1))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,168 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	DATA_KEY_SIZE = 32
+)
+
+var (
+	ErrDecryptionFailed = errors.New("Failed to decrypt stored keys")
+	ErrNotEncrypted     = errors.New("Stored keys are not encrypted")
+)
+
+// KeyEncrypter wraps and unwraps the data keys used to encrypt the stored state
+type KeyEncrypter interface {
+	WrapKey(dataKey []byte) (string, error)
+	UnwrapKey(wrapped string) ([]byte, error)
+}
+
+// EncryptedStorage encrypts the unseal keys, recovery keys and root token with
+// AES-256-GCM before handing the state to another KeyStorage. Each Persist uses
+// a new data key, stored alongside the state after being wrapped by the KeyEncrypter.
+type EncryptedStorage struct {
+	storage   KeyStorage
+	encrypter KeyEncrypter
+
+	// allowPlaintext accepts a state stored before encryption was enabled. It is
+	// only meant for migrating, as anyone able to write the storage could
+	// otherwise replace the encrypted state with keys of their own.
+	allowPlaintext bool
+}
+
+func NewEncryptedStorage(storage KeyStorage, encrypter KeyEncrypter, allowPlaintext bool) KeyStorage {
+	return &EncryptedStorage{storage: storage, encrypter: encrypter, allowPlaintext: allowPlaintext}
+}
+
+func (encrypted *EncryptedStorage) Persist(state vault.InitState) (bool, error) {
+	dataKey := make([]byte, DATA_KEY_SIZE)
+	if _, err := rand.Read(dataKey); err != nil {
+		return false, err
+	}
+	wrapped, err := encrypted.encrypter.WrapKey(dataKey)
+	if err != nil {
+		return false, fmt.Errorf("Failed to wrap data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	state.Keys = encryptValues(aead, state.Keys, "unseal_keys")
+	state.RecoveryKeys = encryptValues(aead, state.RecoveryKeys, "recovery_keys")
+	state.BackupKeys = encryptValues(aead, state.BackupKeys, "backup_unseal_keys")
+	if state.RootToken != "" {
+		state.RootToken = encryptValue(aead, state.RootToken, "root_key")
+	}
+	state.EncryptedDataKey = wrapped
+	return encrypted.storage.Persist(state)
+}
+
+func (encrypted *EncryptedStorage) Fetch() (*vault.InitState, error) {
+	stored, err := encrypted.storage.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	state := *stored
+	if state.EncryptedDataKey == "" {
+		if !encrypted.allowPlaintext {
+			return nil, ErrNotEncrypted
+		}
+		// Written before encryption was enabled, it will be encrypted when next persisted
+		log.Println("Warning: stored keys are not encrypted")
+		return &state, nil
+	}
+
+	dataKey, err := encrypted.encrypter.UnwrapKey(state.EncryptedDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unwrap data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Keys, err = decryptValues(aead, state.Keys, "unseal_keys"); err != nil {
+		return nil, err
+	}
+	if state.RecoveryKeys, err = decryptValues(aead, state.RecoveryKeys, "recovery_keys"); err != nil {
+		return nil, err
+	}
+	if state.BackupKeys, err = decryptValues(aead, state.BackupKeys, "backup_unseal_keys"); err != nil {
+		return nil, err
+	}
+	if state.RootToken != "" {
+		if state.RootToken, err = decryptValue(aead, state.RootToken, "root_key"); err != nil {
+			return nil, err
+		}
+	}
+	state.EncryptedDataKey = ""
+	return &state, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptValue seals the value with a random nonce, authenticating the name of
+// the entry so that values cannot be swapped between entries
+func encryptValue(aead cipher.AEAD, value string, name string) string {
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed)
+}
+
+func decryptValue(aead cipher.AEAD, value string, name string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: invalid %v", ErrDecryptionFailed, name)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v: %v", ErrDecryptionFailed, name, err)
+	}
+	return string(plaintext), nil
+}
+
+// encryptValues seals each value under its name and index, so that the values
+// cannot be reordered either
+func encryptValues(aead cipher.AEAD, values []string, name string) []string {
+	if values == nil {
+		return nil
+	}
+	encrypted := []string{}
+	for index, value := range values {
+		encrypted = append(encrypted, encryptValue(aead, value, fmt.Sprintf("%v/%d", name, index)))
+	}
+	return encrypted
+}
+
+func decryptValues(aead cipher.AEAD, values []string, name string) ([]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	decrypted := []string{}
+	for index, value := range values {
+		plaintext, err := decryptValue(aead, value, fmt.Sprintf("%v/%d", name, index))
+		if err != nil {
+			return nil, err
+		}
+		decrypted = append(decrypted, plaintext)
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,118 @@
+package secret
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestEncrypter(t *testing.T) KeyEncrypter {
+	key, _ := GenerateKeyEncryptionKey()
+	encrypter, err := NewStaticKeyEncrypter([]byte(key))
+	assert.Nil(t, err)
+	return encrypter
+}
+
+func TestEncryptedStorage_PersistAndFetch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault-keys.json")
+	file, _ := NewFileSecretStorage(path)
+	storage := NewEncryptedStorage(file, newTestEncrypter(t), false)
+
+	state := vault.InitState{Keys: []string{"key-a", "key-b"}, RootToken: "root-token", Threshold: 2, RecoveryKeys: []string{"recovery-a"}}
+	ok, err := storage.Persist(state)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	data, _ := os.ReadFile(path)
+	for _, secret := range []string{"key-a", "key-b", "root-token", "recovery-a"} {
+		assert.NotContains(t, string(data), secret)
+	}
+	assert.Contains(t, string(data), "encrypted_data_key")
+
+	fetched, err := storage.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, state, *fetched)
+}
+
+func TestEncryptedStorage_WrongKey(t *testing.T) {
+	file, _ := NewFileSecretStorage(filepath.Join(t.TempDir(), "vault-keys.json"))
+	NewEncryptedStorage(file, newTestEncrypter(t), false).Persist(vault.InitState{Keys: []string{"a"}, Threshold: 1})
+
+	_, err := NewEncryptedStorage(file, newTestEncrypter(t), false).Fetch()
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+}
+
+func TestEncryptedStorage_SwappedValues(t *testing.T) {
+	file, _ := NewFileSecretStorage(filepath.Join(t.TempDir(), "vault-keys.json"))
+	encrypter := newTestEncrypter(t)
+	storage := NewEncryptedStorage(file, encrypter, false)
+	storage.Persist(vault.InitState{Keys: []string{"a"}, RootToken: "root", Threshold: 1})
+
+	stored, _ := file.Fetch()
+	stored.Keys, stored.RootToken = []string{stored.RootToken}, stored.Keys[0]
+	file.Persist(*stored)
+
+	_, err := storage.Fetch()
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+}
+
+func TestEncryptedStorage_Unencrypted(t *testing.T) {
+	file, _ := NewFileSecretStorage(filepath.Join(t.TempDir(), "vault-keys.json"))
+	state := vault.InitState{Keys: []string{"a"}, RootToken: "root", Threshold: 1}
+	file.Persist(state)
+
+	_, err := NewEncryptedStorage(file, newTestEncrypter(t), false).Fetch()
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	fetched, err := NewEncryptedStorage(file, newTestEncrypter(t), true).Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, state, *fetched)
+}
+
+func TestEncryptedStorage_ReorderedValues(t *testing.T) {
+	file, _ := NewFileSecretStorage(filepath.Join(t.TempDir(), "vault-keys.json"))
+	storage := NewEncryptedStorage(file, newTestEncrypter(t), false)
+	storage.Persist(vault.InitState{Keys: []string{"a", "b"}, Threshold: 1})
+
+	stored, _ := file.Fetch()
+	stored.Keys = []string{stored.Keys[1], stored.Keys[0]}
+	file.Persist(*stored)
+
+	_, err := storage.Fetch()
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+}
+
+func TestStaticKeyEncrypter_InvalidKey(t *testing.T) {
+	_, err := NewStaticKeyEncrypter([]byte("too short"))
+	assert.NotNil(t, err)
+
+	raw := []byte(strings.Repeat("k", DATA_KEY_SIZE))
+	_, err = NewStaticKeyEncrypter(raw)
+	assert.Nil(t, err)
+}
+
+func TestTransitKeyEncrypter(t *testing.T) {
+	client := new(mocking.VaultMock)
+	dataKey := []byte("data key")
+	encoded := base64.StdEncoding.EncodeToString(dataKey)
+	client.On("Write", mock.Anything, "token", "transit/encrypt/unseal", map[string]interface{}{"plaintext": encoded}).
+		Return(map[string]interface{}{"ciphertext": "vault:v1:abc"}, nil)
+	client.On("Write", mock.Anything, "token", "transit/decrypt/unseal", map[string]interface{}{"ciphertext": "vault:v1:abc"}).
+		Return(map[string]interface{}{"plaintext": encoded}, nil)
+
+	encrypter := NewTransitKeyEncrypter(client, "token", "", "unseal")
+	wrapped, err := encrypter.WrapKey(dataKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "vault:v1:abc", wrapped)
+
+	unwrapped, err := encrypter.UnwrapKey(wrapped)
+	assert.Nil(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+}
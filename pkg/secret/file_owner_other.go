@@ -0,0 +1,10 @@
+//go:build !unix
+
+package secret
+
+import "os"
+
+// File ownership is not checked on platforms without unix permissions
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,137 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+var (
+	ErrInsecureFile = errors.New("Insecure key file")
+)
+
+// FileSecretStorage stores the keys in a local file readable only by the current
+// user, using the same entries as the Kubernetes secret
+type FileSecretStorage struct {
+	path string
+}
+
+func NewFileSecretStorage(path string) (KeyStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create key directory: %w", err)
+	}
+	storage := &FileSecretStorage{path: path}
+
+	// Fail early rather than on the first unseal if an existing file is unsafe
+	if info, err := os.Stat(path); err == nil {
+		if err := checkFile(info); err != nil {
+			return nil, err
+		}
+	}
+	return storage, nil
+}
+
+// Persist replaces the file atomically: the state is written and synced to a
+// temporary file, which is then renamed over the previous file
+func (file *FileSecretStorage) Persist(state vault.InitState) (bool, error) {
+	data, err := marshalEntries(state)
+	if err != nil {
+		return false, err
+	}
+
+	dir := filepath.Dir(file.path)
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(file.path)+".tmp-")
+	if err != nil {
+		return false, fmt.Errorf("Failed to create key file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	if err := temp.Chmod(0600); err != nil {
+		return false, fmt.Errorf("Failed to restrict key file permissions: %w", err)
+	}
+	if _, err := temp.Write(data); err != nil {
+		return false, fmt.Errorf("Failed to write key file: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		return false, fmt.Errorf("Failed to write key file: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return false, fmt.Errorf("Failed to write key file: %w", err)
+	}
+	if err := os.Rename(temp.Name(), file.path); err != nil {
+		return false, fmt.Errorf("Failed to replace key file: %w", err)
+	}
+
+	// Sync the directory so that the rename survives a crash
+	if directory, err := os.Open(dir); err == nil {
+		directory.Sync()
+		directory.Close()
+	}
+	return true, nil
+}
+
+func (file *FileSecretStorage) Fetch() (*vault.InitState, error) {
+	handle, err := os.Open(file.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrKeysNotFound, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open key file: %w", err)
+	}
+	defer handle.Close()
+
+	info, err := handle.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open key file: %w", err)
+	}
+	if err := checkFile(info); err != nil {
+		return nil, err
+	}
+
+	state, err := unmarshalEntries(handle)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read key file: %w", err)
+	}
+	return &state, nil
+}
+
+// marshalEntries encodes the state as a JSON object using the same entries as the Kubernetes secret
+func marshalEntries(state vault.InitState) ([]byte, error) {
+	entries := map[string]string{}
+	for key, value := range encodeData(state) {
+		entries[key] = string(value)
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+func unmarshalEntries(r io.Reader) (vault.InitState, error) {
+	var entries map[string]string
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return vault.InitState{}, err
+	}
+	data := map[string][]byte{}
+	for key, value := range entries {
+		data[key] = []byte(value)
+	}
+	return decodeData(data), nil
+}
+
+// checkFile refuses key files which other users can access or which belong to another user
+func checkFile(info os.FileInfo) error {
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %v is not a regular file", ErrInsecureFile, info.Name())
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%w: %v has mode %v, expected 0600", ErrInsecureFile, info.Name(), info.Mode().Perm())
+	}
+	if owner, ok := fileOwner(info); ok && owner != os.Getuid() {
+		return fmt.Errorf("%w: %v is owned by uid %d, not %d", ErrInsecureFile, info.Name(), owner, os.Getuid())
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorage_PersistAndFetch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "vault-keys.json")
+	storage, err := NewFileSecretStorage(path)
+	assert.Nil(t, err)
+
+	state := vault.InitState{Keys: []string{"a", "b", "c"}, RootToken: "abc", Threshold: 2}
+	ok, err := storage.Persist(state)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	assert.Len(t, entries, 1)
+
+	fetched, err := storage.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, state, *fetched)
+}
+
+func TestFileStorage_RefusesWorldReadable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault-keys.json")
+	storage, _ := NewFileSecretStorage(path)
+	storage.Persist(vault.InitState{Keys: []string{"a"}, Threshold: 1})
+	os.Chmod(path, 0644)
+
+	_, err := storage.Fetch()
+	assert.ErrorIs(t, err, ErrInsecureFile)
+	_, err = NewFileSecretStorage(path)
+	assert.ErrorIs(t, err, ErrInsecureFile)
+}
+
+func TestFileStorage_Missing(t *testing.T) {
+	storage, _ := NewFileSecretStorage(filepath.Join(t.TempDir(), "vault-keys.json"))
+
+	_, err := storage.Fetch()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorIs(t, err, ErrKeysNotFound)
+}
@@ -0,0 +1,129 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	TRANSIT_TIMEOUT = 30 * time.Second
+)
+
+// StaticKeyEncrypter wraps data keys with a fixed AES-256 key encryption key
+type StaticKeyEncrypter struct {
+	aead cipher.AEAD
+}
+
+// NewStaticKeyEncrypter accepts a raw 32 byte key, or the same key base64 encoded
+func NewStaticKeyEncrypter(key []byte) (KeyEncrypter, error) {
+	trimmed := bytes.TrimSpace(key)
+	if decoded, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil && len(decoded) == DATA_KEY_SIZE {
+		key = decoded
+	}
+	if len(key) != DATA_KEY_SIZE {
+		return nil, fmt.Errorf("Invalid key encryption key: expected %d bytes, found %d", DATA_KEY_SIZE, len(key))
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticKeyEncrypter{aead: aead}, nil
+}
+
+// NewFileKeyEncrypter reads the key encryption key from a file
+func NewFileKeyEncrypter(path string) (KeyEncrypter, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read key encryption key: %w", err)
+	}
+	return NewStaticKeyEncrypter(key)
+}
+
+// NewKubernetesKeyEncrypter reads the key encryption key from an entry of a secret,
+// which can live in a namespace the keys secret does not
+func NewKubernetesKeyEncrypter(secretName string, namespace string, dataKey string) (KeyEncrypter, error) {
+	data, err := ReadKubernetesSecret(secretName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := data[dataKey]
+	if !ok {
+		return nil, fmt.Errorf("Secret %v/%v has no entry %q", namespace, secretName, dataKey)
+	}
+	return NewStaticKeyEncrypter(key)
+}
+
+func (static *StaticKeyEncrypter) WrapKey(dataKey []byte) (string, error) {
+	return encryptValue(static.aead, string(dataKey), "data_key"), nil
+}
+
+func (static *StaticKeyEncrypter) UnwrapKey(wrapped string) ([]byte, error) {
+	dataKey, err := decryptValue(static.aead, wrapped, "data_key")
+	return []byte(dataKey), err
+}
+
+// TransitKeyEncrypter wraps data keys with the transit secrets engine of another Vault
+type TransitKeyEncrypter struct {
+	client vault.Vault
+	token  string
+	mount  string
+	key    string
+}
+
+func NewTransitKeyEncrypter(client vault.Vault, token string, mount string, key string) KeyEncrypter {
+	if mount == "" {
+		mount = "transit"
+	}
+	return &TransitKeyEncrypter{client: client, token: token, mount: mount, key: key}
+}
+
+func (transit *TransitKeyEncrypter) WrapKey(dataKey []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TRANSIT_TIMEOUT)
+	defer cancel()
+
+	response, err := transit.client.Write(ctx, transit.token, fmt.Sprintf("%v/encrypt/%v", transit.mount, transit.key), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(dataKey),
+	})
+	if err != nil {
+		return "", err
+	}
+	ciphertext, ok := response["ciphertext"].(string)
+	if !ok {
+		return "", fmt.Errorf("Transit returned no ciphertext")
+	}
+	return ciphertext, nil
+}
+
+func (transit *TransitKeyEncrypter) UnwrapKey(wrapped string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TRANSIT_TIMEOUT)
+	defer cancel()
+
+	response, err := transit.client.Write(ctx, transit.token, fmt.Sprintf("%v/decrypt/%v", transit.mount, transit.key), map[string]interface{}{
+		"ciphertext": wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	plaintext, ok := response["plaintext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("Transit returned no plaintext")
+	}
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// GenerateKeyEncryptionKey returns a new base64 encoded key encryption key
+func GenerateKeyEncryptionKey() (string, error) {
+	key := make([]byte, DATA_KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
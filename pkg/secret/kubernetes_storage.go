@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"encoding/json"
@@ -18,34 +20,101 @@ import (
 )
 
 type KubernetesSecretStorage struct {
-	clientset  kubernetes.Interface
-	namespace  string
-	secretName string
+	clientset   kubernetes.Interface
+	namespace   string
+	secretName  string
+	secretType  v1.SecretType
+	labels      map[string]string
+	annotations map[string]string
+
+	// dataKeys renames the default secret entries, e.g. "root_key" to "token"
+	dataKeys map[string]string
+}
+
+// KubernetesSecretConfig describes the secret holding the keys
+type KubernetesSecretConfig struct {
+	Name        string
+	Namespace   string
+	Type        v1.SecretType
+	Labels      map[string]string
+	Annotations map[string]string
+	DataKeys    map[string]string
 }
 
+const (
+	DEFAULT_SECRET_NAME = "vault-keys"
+	DEFAULT_NAMESPACE   = "default"
+)
+
 var (
 	ErrNotInCluster = errors.New("Kubernetes environment not detected")
+
+	// The namespace of the pod, mounted with its service account token
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	// Secret entries which are always written
+	requiredDataKeys = []string{
+		"root_key",
+		"unseal_keys",
+		"threshold",
+	}
+
+	// Secret entries which are only written when the state uses them
+	optionalDataKeys = []string{
+		"unseal_key_fingerprints",
+		"root_key_fingerprint",
+		"root_key_revoked",
+		"recovery_keys",
+		"recovery_threshold",
+		"recovery_key_fingerprints",
+		"backup_unseal_keys",
+		"backup_threshold",
+		"backup_unseal_key_fingerprints",
+		"encrypted_data_key",
+		"generation",
+	}
 )
 
-func NewKubernetesSecretStorage(secretName string, namespace string) (KeyStorage, error) {
-	// Construct Kubernetes client
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, ErrNotInCluster
+func NewKubernetesSecretStorage(config KubernetesSecretConfig) (KeyStorage, error) {
+	if err := validateDataKeys(config.DataKeys); err != nil {
+		return nil, err
 	}
-	clientset, err := kubernetes.NewForConfig(config)
+
+	clientset, err := newInClusterClientset()
 	if err != nil {
 		return nil, err
 	}
+	return NewKubernetesSecretStorageForClient(clientset, config)
+}
+
+// NewKubernetesSecretStorageForClient stores the keys using the given clientset
+// rather than the in-cluster configuration
+func NewKubernetesSecretStorageForClient(clientset kubernetes.Interface, config KubernetesSecretConfig) (KeyStorage, error) {
+	if err := validateDataKeys(config.DataKeys); err != nil {
+		return nil, err
+	}
+	if config.Name == "" {
+		config.Name = DEFAULT_SECRET_NAME
+	}
+	if config.Namespace == "" {
+		config.Namespace = CurrentNamespace()
+	}
+	if config.Type == "" {
+		config.Type = v1.SecretTypeOpaque
+	}
 
 	storage := &KubernetesSecretStorage{
-		clientset:  clientset,
-		namespace:  namespace,
-		secretName: secretName,
+		clientset:   clientset,
+		namespace:   config.Namespace,
+		secretName:  config.Name,
+		secretType:  config.Type,
+		labels:      config.Labels,
+		annotations: config.Annotations,
+		dataKeys:    config.DataKeys,
 	}
 
 	// Test secret creation
-	_, err = storage.CreateSecret(vault.InitState{Keys: []string{}, RootToken: ""})
+	_, err := storage.CreateSecret(vault.InitState{Keys: []string{}, RootToken: ""})
 	if err != nil {
 		return nil, err
 	}
@@ -53,11 +122,91 @@ func NewKubernetesSecretStorage(secretName string, namespace string) (KeyStorage
 	return storage, nil
 }
 
+// CurrentNamespace returns the namespace vault-init is running in, falling back to "default"
+func CurrentNamespace() string {
+	data, err := os.ReadFile(namespaceFile)
+	if err != nil {
+		return DEFAULT_NAMESPACE
+	}
+	if namespace := strings.TrimSpace(string(data)); namespace != "" {
+		return namespace
+	}
+	return DEFAULT_NAMESPACE
+}
+
+func validateDataKeys(dataKeys map[string]string) error {
+	keys := append(append([]string{}, requiredDataKeys...), optionalDataKeys...)
+	known := map[string]bool{}
+	for _, key := range keys {
+		known[key] = true
+	}
+	for key := range dataKeys {
+		if !known[key] {
+			return fmt.Errorf("Unknown secret data key %q", key)
+		}
+	}
+
+	// Renamed entries must not clash with each other, nor with entries keeping their default name
+	used := map[string]string{}
+	for _, key := range keys {
+		name := key
+		if renamed, ok := dataKeys[key]; ok {
+			name = renamed
+		}
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("Secret data keys %q and %q both use %q", other, key, name)
+		}
+		used[name] = key
+	}
+	return nil
+}
+
+// ReadKubernetesSecret returns the data of an existing secret in the current cluster
+func ReadKubernetesSecret(secretName string, namespace string) (map[string][]byte, error) {
+	clientset, err := newInClusterClientset()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch secret %v/%v: %w", namespace, secretName, err)
+	}
+	return secret.Data, nil
+}
+
+func newInClusterClientset() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, ErrNotInCluster
+	}
+	return kubernetes.NewForConfig(config)
+}
+
 func (kubernetes *KubernetesSecretStorage) Persist(state vault.InitState) (bool, error) {
 	ctx := context.Background()
 
-	dataPatch, err := json.Marshal(v1.Secret{
-		Data: encodeData(state),
+	// Optional entries missing from the state are removed from the secret
+	patchData := map[string]interface{}{}
+	for _, key := range optionalDataKeys {
+		patchData[kubernetes.dataKey(key)] = nil
+	}
+	for key, value := range kubernetes.encode(state) {
+		patchData[key] = value
+	}
+
+	// Configured labels and annotations are added to the existing ones, the type
+	// of an existing secret cannot change
+	metadata := map[string]interface{}{}
+	if len(kubernetes.labels) > 0 {
+		metadata["labels"] = kubernetes.labels
+	}
+	if len(kubernetes.annotations) > 0 {
+		metadata["annotations"] = kubernetes.annotations
+	}
+	dataPatch, err := json.Marshal(map[string]interface{}{
+		"metadata": metadata,
+		"data":     patchData,
 	})
 	if err != nil {
 		return false, err
@@ -75,10 +224,13 @@ func (kubernetes *KubernetesSecretStorage) CreateSecret(state vault.InitState) (
 	_, err := kubernetes.clientset.CoreV1().Secrets(kubernetes.namespace).Create(ctx,
 		&v1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      kubernetes.secretName,
-				Namespace: kubernetes.namespace,
+				Name:        kubernetes.secretName,
+				Namespace:   kubernetes.namespace,
+				Labels:      kubernetes.labels,
+				Annotations: kubernetes.annotations,
 			},
-			Data: encodeData(state),
+			Type: kubernetes.secretType,
+			Data: kubernetes.encode(state),
 		},
 		metav1.CreateOptions{})
 
@@ -98,32 +250,138 @@ func (kubernetes *KubernetesSecretStorage) Fetch() (*vault.InitState, error) {
 	ctx := context.Background()
 
 	secret, err := kubernetes.clientset.CoreV1().Secrets(kubernetes.namespace).Get(ctx, kubernetes.secretName, metav1.GetOptions{})
+	if v1errors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: secret %v/%v does not exist", ErrKeysNotFound, kubernetes.namespace, kubernetes.secretName)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Failed to fetch secret data")
+		return nil, fmt.Errorf("Failed to fetch secret data: %w", err)
 	}
 
-	state := decodeData(secret.Data)
+	state := kubernetes.decode(secret.Data)
+	if isEmptyState(state) {
+		// The empty secret created by NewKubernetesSecretStorage, before Vault was initialized
+		return nil, fmt.Errorf("%w: secret %v/%v is empty", ErrKeysNotFound, kubernetes.namespace, kubernetes.secretName)
+	}
 	return &state, nil
 }
 
+// isEmptyState reports whether a decoded state holds no keys, root token or data key.
+// An empty list of keys is stored as an empty string, which decodes to a single empty key.
+func isEmptyState(state vault.InitState) bool {
+	for _, key := range append(append([]string{}, state.Keys...), state.RecoveryKeys...) {
+		if key != "" {
+			return false
+		}
+	}
+	return state.RootToken == "" && state.EncryptedDataKey == ""
+}
+
+func (kubernetes *KubernetesSecretStorage) dataKey(key string) string {
+	if name, ok := kubernetes.dataKeys[key]; ok {
+		return name
+	}
+	return key
+}
+
+// encode writes the state using the configured data key names
+func (kubernetes *KubernetesSecretStorage) encode(state vault.InitState) map[string][]byte {
+	data := map[string][]byte{}
+	for key, value := range encodeData(state) {
+		data[kubernetes.dataKey(key)] = value
+	}
+	return data
+}
+
+func (kubernetes *KubernetesSecretStorage) decode(data map[string][]byte) vault.InitState {
+	renamed := map[string][]byte{}
+	for _, key := range append(append([]string{}, requiredDataKeys...), optionalDataKeys...) {
+		if value, ok := data[kubernetes.dataKey(key)]; ok {
+			renamed[key] = value
+		}
+	}
+	return decodeData(renamed)
+}
+
 func encodeData(input vault.InitState) map[string][]byte {
 	rootKeyBytes := []byte(input.RootToken)
 	unsealKeysBytes := []byte(arrayToString(input.Keys))
+	thresholdBytes := []byte(strconv.Itoa(input.Threshold))
 
-	return map[string][]byte{
+	data := map[string][]byte{
 		"root_key":    rootKeyBytes,
 		"unseal_keys": unsealKeysBytes,
+		"threshold":   thresholdBytes,
+	}
+
+	// Only written for PGP encrypted state, keeping plaintext secrets unchanged
+	if len(input.KeyFingerprints) > 0 {
+		data["unseal_key_fingerprints"] = []byte(arrayToString(input.KeyFingerprints))
+	}
+	if input.RootTokenFingerprint != "" {
+		data["root_key_fingerprint"] = []byte(input.RootTokenFingerprint)
+	}
+	if input.RootTokenRevoked {
+		data["root_key_revoked"] = []byte(strconv.FormatBool(true))
+	}
+	if len(input.RecoveryKeys) > 0 {
+		data["recovery_keys"] = []byte(arrayToString(input.RecoveryKeys))
+		data["recovery_threshold"] = []byte(strconv.Itoa(input.RecoveryThreshold))
+	}
+	if len(input.RecoveryKeyFingerprints) > 0 {
+		data["recovery_key_fingerprints"] = []byte(arrayToString(input.RecoveryKeyFingerprints))
+	}
+	if len(input.BackupKeys) > 0 {
+		data["backup_unseal_keys"] = []byte(arrayToString(input.BackupKeys))
+		data["backup_threshold"] = []byte(strconv.Itoa(input.BackupThreshold))
+	}
+	if len(input.BackupKeyFingerprints) > 0 {
+		data["backup_unseal_key_fingerprints"] = []byte(arrayToString(input.BackupKeyFingerprints))
 	}
+	if input.EncryptedDataKey != "" {
+		data["encrypted_data_key"] = []byte(input.EncryptedDataKey)
+	}
+	if input.Generation != 0 {
+		data["generation"] = []byte(strconv.FormatInt(input.Generation, 10))
+	}
+	return data
 }
 
 func decodeData(input map[string][]byte) vault.InitState {
 	rootKey := string(input["root_key"])
 	unsealKeys := string(input["unseal_keys"])
 
-	return vault.InitState{
+	// Secrets written before the threshold was recorded decode as 0 (unknown)
+	threshold, _ := strconv.Atoi(string(input["threshold"]))
+
+	state := vault.InitState{
 		RootToken: string(rootKey),
 		Keys:      stringToArray(string(unsealKeys)),
+		Threshold: threshold,
+	}
+
+	if fingerprints, ok := input["unseal_key_fingerprints"]; ok && len(fingerprints) > 0 {
+		state.KeyFingerprints = stringToArray(string(fingerprints))
+	}
+	state.RootTokenFingerprint = string(input["root_key_fingerprint"])
+	state.RootTokenRevoked, _ = strconv.ParseBool(string(input["root_key_revoked"]))
+
+	if recoveryKeys, ok := input["recovery_keys"]; ok && len(recoveryKeys) > 0 {
+		state.RecoveryKeys = stringToArray(string(recoveryKeys))
+		state.RecoveryThreshold, _ = strconv.Atoi(string(input["recovery_threshold"]))
+	}
+	if fingerprints, ok := input["recovery_key_fingerprints"]; ok && len(fingerprints) > 0 {
+		state.RecoveryKeyFingerprints = stringToArray(string(fingerprints))
+	}
+	if backupKeys, ok := input["backup_unseal_keys"]; ok && len(backupKeys) > 0 {
+		state.BackupKeys = stringToArray(string(backupKeys))
+		state.BackupThreshold, _ = strconv.Atoi(string(input["backup_threshold"]))
+	}
+	if fingerprints, ok := input["backup_unseal_key_fingerprints"]; ok && len(fingerprints) > 0 {
+		state.BackupKeyFingerprints = stringToArray(string(fingerprints))
 	}
+	state.EncryptedDataKey = string(input["encrypted_data_key"])
+	state.Generation, _ = strconv.ParseInt(string(input["generation"]), 10, 64)
+	return state
 }
 
 func arrayToString(input []string) string {
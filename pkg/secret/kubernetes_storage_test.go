@@ -1,6 +1,8 @@
 package secret
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mattgill98/vault-init/pkg/vault"
@@ -19,6 +21,7 @@ func TestGetSecretData(t *testing.T) {
 		Data: map[string][]byte{
 			"root_key":    []byte([]byte("abc")),
 			"unseal_keys": []byte([]byte("a,b,c")),
+			"threshold":   []byte([]byte("2")),
 		},
 	}
 
@@ -35,6 +38,7 @@ func TestGetSecretData(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "abc", state.RootToken)
 	assert.Equal(t, []string{"a", "b", "c"}, state.Keys)
+	assert.Equal(t, 2, state.Threshold)
 }
 
 func TestUpdateSecret(t *testing.T) {
@@ -46,6 +50,7 @@ func TestUpdateSecret(t *testing.T) {
 		Data: map[string][]byte{
 			"root_key":    []byte([]byte("abc")),
 			"unseal_keys": []byte([]byte("a,b,c")),
+			"threshold":   []byte([]byte("2")),
 		},
 	}
 
@@ -57,10 +62,132 @@ func TestUpdateSecret(t *testing.T) {
 		secretName: "demo-secret",
 	}
 
-	ok, err := storage.Persist(vault.InitState{Keys: []string{"a", "b", "c"}, RootToken: "abc"})
+	ok, err := storage.Persist(vault.InitState{Keys: []string{"a", "b", "c"}, RootToken: "abc", Threshold: 2})
 	assert.True(t, ok)
 	assert.Nil(t, err)
 
 	object, err := clientset.Tracker().Get(v1.SchemeGroupVersion.WithResource("secrets"), "demo", "demo-secret")
 	assert.Equal(t, secret.Data, (object.(*v1.Secret).Data))
 }
+
+func TestUpdateSecret_RemovesUnusedEntries(t *testing.T) {
+	secret := v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "demo-secret",
+			Namespace: "demo",
+		},
+		Data: map[string][]byte{
+			"root_key":           []byte("abc"),
+			"unseal_keys":        []byte("x,y,z"),
+			"threshold":          []byte("2"),
+			"backup_unseal_keys": []byte("a,b,c"),
+			"backup_threshold":   []byte("2"),
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(&secret)
+
+	storage := KubernetesSecretStorage{
+		clientset:  clientset,
+		namespace:  "demo",
+		secretName: "demo-secret",
+	}
+
+	ok, err := storage.Persist(vault.InitState{Keys: []string{"x", "y", "z"}, RootToken: "abc", Threshold: 2})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	object, err := clientset.Tracker().Get(v1.SchemeGroupVersion.WithResource("secrets"), "demo", "demo-secret")
+	assert.NotContains(t, object.(*v1.Secret).Data, "backup_unseal_keys")
+	assert.NotContains(t, object.(*v1.Secret).Data, "backup_threshold")
+	assert.Equal(t, []byte("x,y,z"), object.(*v1.Secret).Data["unseal_keys"])
+}
+
+func TestEncodeData_RootTokenRevoked(t *testing.T) {
+	state := vault.InitState{Keys: []string{"a"}, Threshold: 1, RootTokenRevoked: true}
+	data := encodeData(state)
+	assert.Equal(t, []byte(""), data["root_key"])
+	assert.Equal(t, state, decodeData(data))
+}
+
+func TestPersist_CustomLayout(t *testing.T) {
+	secret := v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "unsealer",
+			Namespace: "vault",
+			Labels:    map[string]string{"existing": "label"},
+		},
+	}
+	clientset := fake.NewSimpleClientset(&secret)
+
+	storage := KubernetesSecretStorage{
+		clientset:   clientset,
+		namespace:   "vault",
+		secretName:  "unsealer",
+		labels:      map[string]string{"app": "vault"},
+		annotations: map[string]string{"owner": "platform"},
+		dataKeys:    map[string]string{"root_key": "token", "unseal_keys": "keys"},
+	}
+
+	state := vault.InitState{Keys: []string{"a", "b"}, RootToken: "abc", Threshold: 2}
+	ok, err := storage.Persist(state)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	object, _ := clientset.Tracker().Get(v1.SchemeGroupVersion.WithResource("secrets"), "vault", "unsealer")
+	stored := object.(*v1.Secret)
+	assert.Equal(t, []byte("abc"), stored.Data["token"])
+	assert.Equal(t, []byte("a,b"), stored.Data["keys"])
+	assert.NotContains(t, stored.Data, "root_key")
+	assert.Equal(t, map[string]string{"existing": "label", "app": "vault"}, stored.Labels)
+	assert.Equal(t, map[string]string{"owner": "platform"}, stored.Annotations)
+
+	fetched, err := storage.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, state, *fetched)
+}
+
+func TestCreateSecret_Type(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	storage := KubernetesSecretStorage{
+		clientset:  clientset,
+		namespace:  "vault",
+		secretName: "unsealer",
+		secretType: "vault-init/keys",
+		labels:     map[string]string{"app": "vault"},
+	}
+
+	ok, err := storage.CreateSecret(vault.InitState{})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	object, _ := clientset.Tracker().Get(v1.SchemeGroupVersion.WithResource("secrets"), "vault", "unsealer")
+	assert.Equal(t, v1.SecretType("vault-init/keys"), object.(*v1.Secret).Type)
+	assert.Equal(t, map[string]string{"app": "vault"}, object.(*v1.Secret).Labels)
+}
+
+func TestCurrentNamespace(t *testing.T) {
+	defer func(file string) { namespaceFile = file }(namespaceFile)
+
+	namespaceFile = filepath.Join(t.TempDir(), "namespace")
+	assert.Equal(t, DEFAULT_NAMESPACE, CurrentNamespace())
+
+	os.WriteFile(namespaceFile, []byte("vault\n"), 0600)
+	assert.Equal(t, "vault", CurrentNamespace())
+}
+
+func TestValidateDataKeys(t *testing.T) {
+	assert.Nil(t, validateDataKeys(map[string]string{"root_key": "token"}))
+	assert.NotNil(t, validateDataKeys(map[string]string{"root_token": "token"}))
+	assert.NotNil(t, validateDataKeys(map[string]string{"root_key": "keys", "unseal_keys": "keys"}))
+	assert.NotNil(t, validateDataKeys(map[string]string{"threshold": "root_key"}))
+	assert.Nil(t, validateDataKeys(map[string]string{"root_key": "unseal_keys", "unseal_keys": "root_key"}))
+}
+
+func TestFetch_EmptySecret(t *testing.T) {
+	storage, err := NewKubernetesSecretStorageForClient(fake.NewSimpleClientset(), KubernetesSecretConfig{Namespace: "vault"})
+	assert.Nil(t, err)
+
+	_, err = storage.Fetch()
+	assert.ErrorIs(t, err, ErrKeysNotFound)
+}
@@ -1,7 +1,6 @@
 package secret
 
 import (
-	"fmt"
 	"log"
 
 	"github.com/mattgill98/vault-init/pkg/vault"
@@ -38,8 +37,20 @@ func NewMemorySecretStorage(logger Logger) KeyStorage {
 func (memory *memorySecretStorage) Persist(state vault.InitState) (bool, error) {
 	memory.storedState = &state
 	if memory.logger != nil {
-		memory.logger.Printf("Root key: %v", state.RootToken)
+		if state.RootTokenRevoked {
+			memory.logger.Printf("Root key: revoked")
+		} else {
+			memory.logger.Printf("Root key: %v", state.RootToken)
+		}
 		memory.logger.Printf("Seal Keys: %v", state.Keys)
+		memory.logger.Printf("Seal Threshold: %d", state.Threshold)
+		if len(state.RecoveryKeys) > 0 {
+			memory.logger.Printf("Recovery Keys: %v", state.RecoveryKeys)
+			memory.logger.Printf("Recovery Threshold: %d", state.RecoveryThreshold)
+		}
+		if len(state.BackupKeys) > 0 {
+			memory.logger.Printf("Backup Seal Keys: %v", state.BackupKeys)
+		}
 	}
 	return true, nil
 }
@@ -47,7 +58,7 @@ func (memory *memorySecretStorage) Persist(state vault.InitState) (bool, error)
 func (memory *memorySecretStorage) Fetch() (*vault.InitState, error) {
 	state := memory.storedState
 	if state == nil {
-		return nil, fmt.Errorf("State not found")
+		return nil, ErrKeysNotFound
 	}
 	return state, nil
 }
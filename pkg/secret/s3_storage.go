@@ -0,0 +1,206 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	DEFAULT_S3_ENDPOINT = "s3.amazonaws.com"
+	DEFAULT_S3_KEY      = "vault-keys.json"
+	S3_TIMEOUT          = 30 * time.Second
+)
+
+var (
+	ErrKeyObjectChanged = errors.New("Key object was modified since it was read")
+)
+
+// S3StorageConfig holds the location and encryption of the object storing the keys
+type S3StorageConfig struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	Key             string
+	AccessKeyID     string
+	SecretAccessKey string
+	Insecure        bool
+
+	// SSE selects server side encryption: "s3", "kms" or "customer"
+	SSE         string
+	KMSKeyID    string
+	CustomerKey []byte
+
+	// DeleteOldVersions removes the previous versions of the object in a versioned
+	// bucket once the keys are replaced, so that superseded keys are not retained
+	DeleteOldVersions bool
+}
+
+// S3Storage stores the keys as a JSON object in an S3 compatible bucket. Writes
+// are conditional on the object being unchanged since it was last read, so that
+// two instances cannot silently overwrite each other's keys.
+type S3Storage struct {
+	client            *minio.Client
+	bucket            string
+	key               string
+	sse               encrypt.ServerSide
+	deleteOldVersions bool
+
+	// The ETag of the object when last read or written, empty if never seen
+	etag string
+}
+
+func NewS3Storage(config S3StorageConfig) (KeyStorage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("Invalid S3 configuration: no bucket given")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = DEFAULT_S3_ENDPOINT
+	}
+	if config.Key == "" {
+		config.Key = DEFAULT_S3_KEY
+	}
+	sse, err := newServerSideEncryption(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to the AWS environment and instance credentials when no key is configured
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.Static{Value: credentials.Value{AccessKeyID: config.AccessKeyID, SecretAccessKey: config.SecretAccessKey, SignerType: credentials.SignatureV4}},
+		&credentials.EnvAWS{},
+		&credentials.IAM{},
+	})
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !config.Insecure,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid S3 configuration: %w", err)
+	}
+
+	return &S3Storage{
+		client:            client,
+		bucket:            config.Bucket,
+		key:               path.Join(strings.Trim(config.Prefix, "/"), config.Key),
+		sse:               sse,
+		deleteOldVersions: config.DeleteOldVersions,
+	}, nil
+}
+
+func newServerSideEncryption(config S3StorageConfig) (encrypt.ServerSide, error) {
+	switch strings.ToLower(config.SSE) {
+	case "":
+		return nil, nil
+	case "s3":
+		return encrypt.NewSSE(), nil
+	case "kms":
+		return encrypt.NewSSEKMS(config.KMSKeyID, nil)
+	case "customer":
+		if config.Insecure {
+			return nil, fmt.Errorf("Invalid S3 configuration: customer encryption keys require TLS")
+		}
+		return encrypt.NewSSEC(config.CustomerKey)
+	default:
+		return nil, fmt.Errorf("Invalid S3 configuration: unknown server side encryption %q", config.SSE)
+	}
+}
+
+func (storage *S3Storage) Persist(state vault.InitState) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), S3_TIMEOUT)
+	defer cancel()
+
+	data, err := marshalEntries(state)
+	if err != nil {
+		return false, err
+	}
+
+	options := minio.PutObjectOptions{ContentType: "application/json", ServerSideEncryption: storage.sse}
+	if storage.etag != "" {
+		options.SetMatchETag(storage.etag)
+	} else {
+		// Only create the object if no other instance has stored keys in the meantime
+		options.SetMatchETagExcept("*")
+	}
+
+	info, err := storage.client.PutObject(ctx, storage.bucket, storage.key, bytes.NewReader(data), int64(len(data)), options)
+	if err != nil {
+		if status := minio.ToErrorResponse(err).StatusCode; status == http.StatusPreconditionFailed || status == http.StatusConflict {
+			return false, fmt.Errorf("%w: %v already exists or was modified", ErrKeyObjectChanged, storage.key)
+		}
+		return false, fmt.Errorf("Failed to write key object: %w", err)
+	}
+	storage.etag = info.ETag
+
+	if info.VersionID != "" {
+		log.Printf("Stored keys in %v/%v version %v", storage.bucket, storage.key, info.VersionID)
+		if storage.deleteOldVersions {
+			storage.deleteVersions(ctx, info.VersionID)
+		}
+	}
+	return true, nil
+}
+
+func (storage *S3Storage) Fetch() (*vault.InitState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), S3_TIMEOUT)
+	defer cancel()
+
+	object, err := storage.client.GetObject(ctx, storage.bucket, storage.key, storage.getOptions())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch key object: %w", err)
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, fmt.Errorf("%w: %v/%v does not exist", ErrKeysNotFound, storage.bucket, storage.key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch key object: %w", err)
+	}
+	state, err := unmarshalEntries(object)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read key object: %w", err)
+	}
+	storage.etag = info.ETag
+	return &state, nil
+}
+
+// getOptions passes the customer key when reading objects encrypted with SSE-C
+func (storage *S3Storage) getOptions() minio.GetObjectOptions {
+	options := minio.GetObjectOptions{}
+	if storage.sse != nil && storage.sse.Type() == encrypt.SSEC {
+		options.ServerSideEncryption = storage.sse
+	}
+	return options
+}
+
+// deleteVersions removes every version of the key object other than the current one
+func (storage *S3Storage) deleteVersions(ctx context.Context, current string) {
+	objects := storage.client.ListObjects(ctx, storage.bucket, minio.ListObjectsOptions{Prefix: storage.key, WithVersions: true})
+	for object := range objects {
+		if object.Err != nil {
+			log.Printf("Failed to list key object versions: %v", object.Err)
+			return
+		}
+		if object.Key != storage.key || object.VersionID == current {
+			continue
+		}
+		if err := storage.client.RemoveObject(ctx, storage.bucket, storage.key, minio.RemoveObjectOptions{VersionID: object.VersionID}); err != nil {
+			log.Printf("Failed to delete key object version %v: %v", object.VersionID, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewS3Storage_InvalidConfig(t *testing.T) {
+	_, err := NewS3Storage(S3StorageConfig{})
+	assert.NotNil(t, err)
+
+	_, err = NewS3Storage(S3StorageConfig{Bucket: "keys", SSE: "rot13"})
+	assert.NotNil(t, err)
+
+	_, err = NewS3Storage(S3StorageConfig{Bucket: "keys", SSE: "customer", CustomerKey: make([]byte, 32), Insecure: true})
+	assert.NotNil(t, err)
+
+	storage, err := NewS3Storage(S3StorageConfig{Bucket: "keys", Prefix: "/cluster-a/", SSE: "s3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "cluster-a/vault-keys.json", storage.(*S3Storage).key)
+}
+
+// newMinioConfig connects to the MinIO started by "make minio-container", skipping
+// the test unless VAULT_INIT_TEST_S3_ENDPOINT is set
+func newMinioConfig(t *testing.T) S3StorageConfig {
+	endpoint := os.Getenv("VAULT_INIT_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("VAULT_INIT_TEST_S3_ENDPOINT not set")
+	}
+	config := S3StorageConfig{
+		Endpoint:        endpoint,
+		Bucket:          "vault-init-test",
+		Prefix:          fmt.Sprintf("%v-%d", t.Name(), time.Now().UnixNano()),
+		AccessKeyID:     os.Getenv("VAULT_INIT_TEST_S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("VAULT_INIT_TEST_S3_SECRET_ACCESS_KEY"),
+		Insecure:        true,
+	}
+
+	storage, err := NewS3Storage(config)
+	assert.Nil(t, err)
+	client := storage.(*S3Storage).client
+	if exists, err := client.BucketExists(context.Background(), config.Bucket); err == nil && !exists {
+		assert.Nil(t, client.MakeBucket(context.Background(), config.Bucket, minio.MakeBucketOptions{}))
+	}
+	return config
+}
+
+func TestS3Storage_PersistAndFetch(t *testing.T) {
+	config := newMinioConfig(t)
+	storage, _ := NewS3Storage(config)
+
+	state := vault.InitState{Keys: []string{"a", "b", "c"}, RootToken: "root", Threshold: 2}
+	ok, err := storage.Persist(state)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	fetched, err := storage.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, state, *fetched)
+
+	state.RootTokenRevoked = true
+	ok, err = storage.Persist(state)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+}
+
+func TestS3Storage_ConditionalWrites(t *testing.T) {
+	config := newMinioConfig(t)
+	first, _ := NewS3Storage(config)
+	second, _ := NewS3Storage(config)
+
+	first.Persist(vault.InitState{Keys: []string{"a"}, Threshold: 1})
+
+	// The object was never read by the second instance
+	_, err := second.Persist(vault.InitState{Keys: []string{"b"}, Threshold: 1})
+	assert.ErrorIs(t, err, ErrKeyObjectChanged)
+
+	second.Fetch()
+	_, err = first.Persist(vault.InitState{Keys: []string{"c"}, Threshold: 1})
+	assert.Nil(t, err)
+
+	// The object changed since the second instance read it
+	_, err = second.Persist(vault.InitState{Keys: []string{"b"}, Threshold: 1})
+	assert.ErrorIs(t, err, ErrKeyObjectChanged)
+
+	fetched, _ := second.Fetch()
+	assert.Equal(t, []string{"c"}, fetched.Keys)
+}
@@ -1,6 +1,16 @@
 package secret
 
-import "github.com/mattgill98/vault-init/pkg/vault"
+import (
+	"errors"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+var (
+	// ErrKeysNotFound is returned by Fetch when no keys have been stored yet,
+	// as opposed to the storage being unavailable
+	ErrKeysNotFound = errors.New("No keys have been stored")
+)
 
 type KeyStorage interface {
 	Persist(state vault.InitState) (bool, error)
@@ -0,0 +1,64 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalSink stores snapshots in a directory, such as a mounted persistent volume
+type LocalSink struct {
+	dir string
+}
+
+func NewLocalSink(dir string) (*LocalSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create snapshot directory: %w", err)
+	}
+	return &LocalSink{dir: dir}, nil
+}
+
+// Write stores the file atomically, so that a partial snapshot is never visible
+func (sink *LocalSink) Write(ctx context.Context, name string, r io.Reader, size int64) error {
+	temp, err := os.CreateTemp(sink.dir, "."+name+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	if _, err := io.Copy(temp, r); err != nil {
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filepath.Join(sink.dir, name))
+}
+
+func (sink *LocalSink) Read(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(sink.dir, name))
+}
+
+func (sink *LocalSink) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(sink.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (sink *LocalSink) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(sink.dir, name))
+}
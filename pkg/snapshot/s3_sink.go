@@ -0,0 +1,89 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config holds the connection settings of an S3 compatible bucket
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Insecure        bool
+}
+
+// S3Sink stores snapshots in an S3 compatible bucket
+type S3Sink struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3Sink(config S3Config) (*S3Sink, error) {
+	// Fall back to the AWS environment and instance credentials when no key is configured
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.Static{Value: credentials.Value{AccessKeyID: config.AccessKeyID, SecretAccessKey: config.SecretAccessKey, SignerType: credentials.SignatureV4}},
+		&credentials.EnvAWS{},
+		&credentials.IAM{},
+	})
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !config.Insecure,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid S3 configuration: %w", err)
+	}
+	return &S3Sink{client: client, bucket: config.Bucket, prefix: strings.Trim(config.Prefix, "/")}, nil
+}
+
+func (sink *S3Sink) Write(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := sink.client.PutObject(ctx, sink.bucket, sink.key(name), r, size, minio.PutObjectOptions{})
+	return err
+}
+
+func (sink *S3Sink) Read(ctx context.Context, name string) (io.ReadCloser, error) {
+	object, err := sink.client.GetObject(ctx, sink.bucket, sink.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, so check the object exists before handing it out
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return object, nil
+}
+
+func (sink *S3Sink) List(ctx context.Context) ([]string, error) {
+	prefix := ""
+	if sink.prefix != "" {
+		prefix = sink.prefix + "/"
+	}
+	names := []string{}
+	for object := range sink.client.ListObjects(ctx, sink.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		names = append(names, strings.TrimPrefix(object.Key, prefix))
+	}
+	return names, nil
+}
+
+func (sink *S3Sink) Delete(ctx context.Context, name string) error {
+	return sink.client.RemoveObject(ctx, sink.bucket, sink.key(name), minio.RemoveObjectOptions{})
+}
+
+func (sink *S3Sink) key(name string) string {
+	return path.Join(sink.prefix, name)
+}
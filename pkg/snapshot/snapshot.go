@@ -0,0 +1,226 @@
+package snapshot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	SNAPSHOT_PREFIX    = "vault-snapshot-"
+	SNAPSHOT_SUFFIX    = ".snap"
+	CHECKSUM_SUFFIX    = ".sha256"
+	SNAPSHOT_TIME_FORM = "20060102T150405Z"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("Snapshot checksum does not match")
+	ErrNoSnapshots      = errors.New("No snapshots found")
+)
+
+// Sink stores snapshot files, e.g. in a local directory or an S3 bucket. Write
+// is given the size of the file, so that uploads do not need to buffer it.
+type Sink interface {
+	Write(ctx context.Context, name string, r io.Reader, size int64) error
+	Read(ctx context.Context, name string) (io.ReadCloser, error)
+	List(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// Retention limits the snapshots kept. A zero value keeps everything.
+type Retention struct {
+	Count  int
+	MaxAge time.Duration
+}
+
+type Manager struct {
+	sink      Sink
+	retention Retention
+}
+
+func NewManager(sink Sink, retention Retention) *Manager {
+	return &Manager{sink: sink, retention: retention}
+}
+
+// Backup takes a snapshot of Vault and stores it, along with its SHA-256 checksum,
+// before applying the retention policy. It returns the name of the snapshot.
+func (manager *Manager) Backup(ctx context.Context, client vault.Vault, token string, now time.Time) (string, error) {
+	// Vault is streamed to a temporary file first, so that a failed snapshot never reaches the sink
+	file, err := os.CreateTemp("", SNAPSHOT_PREFIX)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	if err := client.Snapshot(ctx, token, io.MultiWriter(file, hash)); err != nil {
+		return "", fmt.Errorf("Failed to take snapshot: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	// The checksum is stored first: only names ending in SNAPSHOT_SUFFIX are listed
+	// as snapshots, so a snapshot is never visible without its checksum
+	name := SNAPSHOT_PREFIX + now.UTC().Format(SNAPSHOT_TIME_FORM) + SNAPSHOT_SUFFIX
+	checksum := hex.EncodeToString(hash.Sum(nil)) + "\n"
+	if err := manager.sink.Write(ctx, name+CHECKSUM_SUFFIX, strings.NewReader(checksum), int64(len(checksum))); err != nil {
+		return "", fmt.Errorf("Failed to store checksum of %v: %w", name, err)
+	}
+	if err := manager.sink.Write(ctx, name, file, info.Size()); err != nil {
+		if err := manager.sink.Delete(ctx, name+CHECKSUM_SUFFIX); err != nil {
+			log.Printf("Failed to delete checksum of %v: %v", name, err)
+		}
+		return "", fmt.Errorf("Failed to store snapshot %v: %w", name, err)
+	}
+
+	if err := manager.Prune(ctx, now); err != nil {
+		log.Printf("Failed to apply snapshot retention: %v", err)
+	}
+	return name, nil
+}
+
+// Snapshots lists the stored snapshots, oldest first
+func (manager *Manager) Snapshots(ctx context.Context) ([]string, error) {
+	names, err := manager.sink.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list snapshots: %w", err)
+	}
+	snapshots := []string{}
+	for _, name := range names {
+		if _, ok := snapshotTime(name); ok {
+			snapshots = append(snapshots, name)
+		}
+	}
+	// The timestamp format sorts chronologically
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// Latest returns the name of the most recent snapshot
+func (manager *Manager) Latest(ctx context.Context) (string, error) {
+	snapshots, err := manager.Snapshots(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(snapshots) == 0 {
+		return "", ErrNoSnapshots
+	}
+	return snapshots[len(snapshots)-1], nil
+}
+
+// Prune deletes the snapshots which fall outside of the retention policy
+func (manager *Manager) Prune(ctx context.Context, now time.Time) error {
+	snapshots, err := manager.Snapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	for index, name := range snapshots {
+		keep := len(snapshots) - index
+		expired := manager.retention.Count > 0 && keep > manager.retention.Count
+		if created, _ := snapshotTime(name); manager.retention.MaxAge > 0 && now.Sub(created) > manager.retention.MaxAge {
+			expired = true
+		}
+		// The latest snapshot is always kept
+		if !expired || index == len(snapshots)-1 {
+			continue
+		}
+
+		log.Printf("Deleting snapshot %v", name)
+		if err := manager.sink.Delete(ctx, name); err != nil {
+			return fmt.Errorf("Failed to delete snapshot %v: %w", name, err)
+		}
+		if err := manager.sink.Delete(ctx, name+CHECKSUM_SUFFIX); err != nil {
+			log.Printf("Failed to delete checksum of %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Restore verifies a stored snapshot against its checksum and installs it in Vault
+func (manager *Manager) Restore(ctx context.Context, client vault.Vault, token string, name string, force bool) error {
+	file, err := manager.fetch(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := client.RestoreSnapshot(ctx, token, file, force); err != nil {
+		return fmt.Errorf("Failed to restore snapshot %v: %w", name, err)
+	}
+	return nil
+}
+
+// fetch downloads a snapshot to a temporary file and verifies its checksum
+func (manager *Manager) fetch(ctx context.Context, name string) (*os.File, error) {
+	checksum, err := manager.readChecksum(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := manager.sink.Read(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read snapshot %v: %w", name, err)
+	}
+	defer reader.Close()
+
+	file, err := os.CreateTemp("", SNAPSHOT_PREFIX)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create snapshot file: %w", err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), reader); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("Failed to read snapshot %v: %w", name, err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != checksum {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("%w: %v has checksum %v, expected %v", ErrChecksumMismatch, name, actual, checksum)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+func (manager *Manager) readChecksum(ctx context.Context, name string) (string, error) {
+	reader, err := manager.sink.Read(ctx, name+CHECKSUM_SUFFIX)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read checksum of %v: %w", name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read checksum of %v: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func snapshotTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, SNAPSHOT_PREFIX) || !strings.HasSuffix(name, SNAPSHOT_SUFFIX) {
+		return time.Time{}, false
+	}
+	created, err := time.Parse(SNAPSHOT_TIME_FORM, strings.TrimSuffix(strings.TrimPrefix(name, SNAPSHOT_PREFIX), SNAPSHOT_SUFFIX))
+	return created, err == nil
+}
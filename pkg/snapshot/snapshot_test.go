@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newSnapshotVault(data string) *mocking.VaultMock {
+	client := new(mocking.VaultMock)
+	client.On("Snapshot", mock.Anything, "root", mock.Anything).Run(func(args mock.Arguments) {
+		io.WriteString(args.Get(2).(io.Writer), data)
+	}).Return(nil)
+	return client
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	sink, _ := NewLocalSink(dir)
+	manager := NewManager(sink, Retention{})
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	client := newSnapshotVault("snapshot data")
+	name, err := manager.Backup(context.Background(), client, "root", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "vault-snapshot-20240601T120000Z.snap", name)
+
+	checksum, _ := os.ReadFile(filepath.Join(dir, name+CHECKSUM_SUFFIX))
+	assert.Equal(t, "e7dee7266896538616b630a5da40a90e007726a383e005a9c9c5dd0c2daf9329\n", string(checksum))
+
+	var restored bytes.Buffer
+	client.On("RestoreSnapshot", mock.Anything, "root", mock.Anything, true).Run(func(args mock.Arguments) {
+		io.Copy(&restored, args.Get(2).(io.Reader))
+	}).Return(nil)
+	err = manager.Restore(context.Background(), client, "root", name, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "snapshot data", restored.String())
+}
+
+func TestRestore_ChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	sink, _ := NewLocalSink(dir)
+	manager := NewManager(sink, Retention{})
+
+	client := newSnapshotVault("snapshot data")
+	name, _ := manager.Backup(context.Background(), client, "root", time.Now())
+	os.WriteFile(filepath.Join(dir, name), []byte("corrupted"), 0600)
+
+	err := manager.Restore(context.Background(), client, "root", name, false)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	client.AssertNotCalled(t, "RestoreSnapshot", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	sink, _ := NewLocalSink(dir)
+	manager := NewManager(sink, Retention{Count: 3, MaxAge: 48 * time.Hour})
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	client := newSnapshotVault("snapshot data")
+	for day := 0; day < 5; day++ {
+		_, err := manager.Backup(context.Background(), client, "root", start.Add(time.Duration(day)*24*time.Hour))
+		assert.Nil(t, err)
+	}
+
+	// The count keeps the last three days, the maximum age only the last two
+	snapshots, _ := manager.Snapshots(context.Background())
+	assert.Equal(t, []string{"vault-snapshot-20240603T000000Z.snap", "vault-snapshot-20240604T000000Z.snap", "vault-snapshot-20240605T000000Z.snap"}, snapshots)
+	_, err := os.Stat(filepath.Join(dir, "vault-snapshot-20240601T000000Z.snap"+CHECKSUM_SUFFIX))
+	assert.True(t, os.IsNotExist(err))
+
+	latest, _ := manager.Latest(context.Background())
+	assert.Equal(t, "vault-snapshot-20240605T000000Z.snap", latest)
+}
+
+// failingSink rejects writes of snapshots, but not of their checksums
+type failingSink struct {
+	*LocalSink
+	sizes map[string]int64
+}
+
+func (sink *failingSink) Write(ctx context.Context, name string, r io.Reader, size int64) error {
+	sink.sizes[name] = size
+	if strings.HasSuffix(name, SNAPSHOT_SUFFIX) {
+		return fmt.Errorf("Mock error")
+	}
+	return sink.LocalSink.Write(ctx, name, r, size)
+}
+
+func TestBackup_WriteFailureLeavesNoChecksum(t *testing.T) {
+	dir := t.TempDir()
+	local, _ := NewLocalSink(dir)
+	sink := &failingSink{LocalSink: local, sizes: map[string]int64{}}
+	manager := NewManager(sink, Retention{})
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	_, err := manager.Backup(context.Background(), newSnapshotVault("snapshot data"), "root", now)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(len("snapshot data")), sink.sizes["vault-snapshot-20240601T120000Z.snap"])
+
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+	_, err = manager.Latest(context.Background())
+	assert.ErrorIs(t, err, ErrNoSnapshots)
+}
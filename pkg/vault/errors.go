@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when Vault responds with an unsuccessful status code
+type APIError struct {
+	StatusCode int
+	Errors     []string
+	Endpoint   string
+}
+
+type ErrorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// Sentinels for common failures, matched against an APIError using errors.Is
+var (
+	ErrAlreadyInitialized = errors.New("Vault is already initialized")
+	ErrNotInitialized     = errors.New("Vault is not initialized")
+	ErrSealed             = errors.New("Vault is sealed")
+	ErrInvalidKey         = errors.New("Invalid unseal key")
+	ErrPermissionDenied   = errors.New("Permission denied")
+	ErrRateLimited        = errors.New("Rate limited")
+	ErrNotFound           = errors.New("Not found")
+)
+
+func (err *APIError) Error() string {
+	if len(err.Errors) == 0 {
+		return fmt.Sprintf("Vault operation failed [%d]: %v", err.StatusCode, err.Endpoint)
+	}
+	return fmt.Sprintf("Vault operation failed [%d]: %v: %v", err.StatusCode, err.Endpoint, strings.Join(err.Errors, "; "))
+}
+
+func (err *APIError) Is(target error) bool {
+	switch target {
+	case ErrAlreadyInitialized:
+		return err.contains("already initialized")
+	case ErrNotInitialized:
+		return err.contains("not initialized")
+	case ErrSealed:
+		return err.StatusCode == http.StatusServiceUnavailable || err.contains("vault is sealed")
+	case ErrInvalidKey:
+		return err.contains("invalid key") || err.contains("must be a valid hex or base64") || err.contains("message authentication failed")
+	case ErrPermissionDenied:
+		return err.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return err.StatusCode == http.StatusTooManyRequests
+	case ErrNotFound:
+		return err.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+func (err *APIError) contains(message string) bool {
+	for _, e := range err.Errors {
+		if strings.Contains(strings.ToLower(e), message) {
+			return true
+		}
+	}
+	return false
+}
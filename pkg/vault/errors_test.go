@@ -0,0 +1,45 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIError_Sentinels(t *testing.T) {
+	cases := map[error]*APIError{
+		ErrAlreadyInitialized: {StatusCode: 400, Errors: []string{"Vault is already initialized"}},
+		ErrNotInitialized:     {StatusCode: 400, Errors: []string{"Vault is not initialized"}},
+		ErrSealed:             {StatusCode: 503, Errors: []string{"error performing token check: Vault is sealed"}},
+		ErrInvalidKey:         {StatusCode: 400, Errors: []string{"'key' must be a valid hex or base64 string"}},
+		ErrPermissionDenied:   {StatusCode: 403, Errors: []string{"permission denied"}},
+		ErrRateLimited:        {StatusCode: 429, Errors: []string{"request path sys/unseal: rate limit quota exceeded"}},
+	}
+	for sentinel, apiError := range cases {
+		for other := range cases {
+			assert.Equal(t, sentinel == other, errors.Is(apiError, other), "%v is %v", apiError, other)
+		}
+	}
+}
+
+func TestVaultRequest_ParsesErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":["Vault is already initialized"]}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	_, err := client.Initialize(context.Background(), InitOptions{SecretShares: 1, SecretThreshold: 1})
+	assert.ErrorIs(t, err, ErrAlreadyInitialized)
+
+	var apiError *APIError
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, http.StatusBadRequest, apiError.StatusCode)
+	assert.Equal(t, "/v1/sys/init", apiError.Endpoint)
+	assert.Equal(t, "Vault operation failed [400]: /v1/sys/init: Vault is already initialized", err.Error())
+}
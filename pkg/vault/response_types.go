@@ -1,47 +1,248 @@
 package vault
 
+import "time"
+
 // JSON API types
 
 type InitRequest struct {
-	SecretShares    int `json:"secret_shares"`
-	SecretThreshold int `json:"secret_threshold"`
+	SecretShares      int      `json:"secret_shares,omitempty"`
+	SecretThreshold   int      `json:"secret_threshold,omitempty"`
+	StoredShares      int      `json:"stored_shares,omitempty"`
+	PGPKeys           []string `json:"pgp_keys,omitempty"`
+	RootTokenPGPKey   string   `json:"root_token_pgp_key,omitempty"`
+	RecoveryShares    int      `json:"recovery_shares,omitempty"`
+	RecoveryThreshold int      `json:"recovery_threshold,omitempty"`
+	RecoveryPGPKeys   []string `json:"recovery_pgp_keys,omitempty"`
 }
 
 type InitResponse struct {
-	Keys       []string `json:"keys"`
-	KeysBase64 []string `json:"keys_base64"`
-	RootToken  string   `json:"root_token"`
+	Keys               []string `json:"keys"`
+	KeysBase64         []string `json:"keys_base64"`
+	RecoveryKeys       []string `json:"recovery_keys"`
+	RecoveryKeysBase64 []string `json:"recovery_keys_base64"`
+	RootToken          string   `json:"root_token"`
 }
 
 type UnsealRequest struct {
-	Key   string `json:"key"`
-	Reset bool   `json:"reset"`
+	Key     string `json:"key"`
+	Reset   bool   `json:"reset"`
+	Migrate bool   `json:"migrate,omitempty"`
 }
 
 type UnsealResponse struct {
-	Sealed   bool `json:"sealed"`
-	T        int  `json:"t"`
-	N        int  `json:"n"`
-	Progress int  `json:"progress"`
+	Sealed   bool   `json:"sealed"`
+	T        int    `json:"t"`
+	N        int    `json:"n"`
+	Progress int    `json:"progress"`
+	Nonce    string `json:"nonce"`
+}
+
+type SealStatusResponse struct {
+	Type         string `json:"type"`
+	Initialized  bool   `json:"initialized"`
+	Sealed       bool   `json:"sealed"`
+	T            int    `json:"t"`
+	N            int    `json:"n"`
+	Progress     int    `json:"progress"`
+	Nonce        string `json:"nonce"`
+	Version      string `json:"version"`
+	Migration    bool   `json:"migration"`
+	RecoverySeal bool   `json:"recovery_seal"`
+	StorageType  string `json:"storage_type"`
+}
+
+type HealthResponse struct {
+	Initialized                bool   `json:"initialized"`
+	Sealed                     bool   `json:"sealed"`
+	Standby                    bool   `json:"standby"`
+	PerformanceStandby         bool   `json:"performance_standby"`
+	ReplicationPerformanceMode string `json:"replication_performance_mode"`
+	ReplicationDRMode          string `json:"replication_dr_mode"`
+	ServerTimeUTC              int64  `json:"server_time_utc"`
+	Version                    string `json:"version"`
+	Enterprise                 bool   `json:"enterprise"`
+	ClusterName                string `json:"cluster_name"`
+	ClusterID                  string `json:"cluster_id"`
+}
+
+type RekeyInitRequest struct {
+	SecretShares        int      `json:"secret_shares"`
+	SecretThreshold     int      `json:"secret_threshold"`
+	PGPKeys             []string `json:"pgp_keys,omitempty"`
+	RequireVerification bool     `json:"require_verification"`
+}
+
+type RekeyUpdateRequest struct {
+	Key   string `json:"key"`
+	Nonce string `json:"nonce"`
+}
+
+type RekeyResponse struct {
+	Nonce                string   `json:"nonce"`
+	Started              bool     `json:"started"`
+	T                    int      `json:"t"`
+	N                    int      `json:"n"`
+	Progress             int      `json:"progress"`
+	Required             int      `json:"required"`
+	Complete             bool     `json:"complete"`
+	Keys                 []string `json:"keys"`
+	KeysBase64           []string `json:"keys_base64"`
+	PGPFingerprints      []string `json:"pgp_fingerprints"`
+	VerificationRequired bool     `json:"verification_required"`
+	VerificationNonce    string   `json:"verification_nonce"`
+}
+
+type KeyStatusResponse struct {
+	Term        int       `json:"term"`
+	InstallTime time.Time `json:"install_time"`
+	Encryptions int64     `json:"encryptions"`
+}
+
+// DataResponse is the generic response envelope of the Vault API
+type DataResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+type GenerateRootUpdateRequest struct {
+	Key   string `json:"key"`
+	Nonce string `json:"nonce"`
+}
+
+type GenerateRootResponse struct {
+	Nonce        string `json:"nonce"`
+	Started      bool   `json:"started"`
+	Progress     int    `json:"progress"`
+	Required     int    `json:"required"`
+	Complete     bool   `json:"complete"`
+	EncodedToken string `json:"encoded_token"`
+	OTP          string `json:"otp"`
+	OTPLength    int    `json:"otp_length"`
+}
+
+type RaftJoinRequest struct {
+	LeaderAPIAddr       string `json:"leader_api_addr"`
+	LeaderCACert        string `json:"leader_ca_cert,omitempty"`
+	LeaderClientCert    string `json:"leader_client_cert,omitempty"`
+	LeaderClientKey     string `json:"leader_client_key,omitempty"`
+	LeaderTLSServerName string `json:"leader_tls_servername,omitempty"`
+}
+
+type RaftJoinResponse struct {
+	Joined bool `json:"joined"`
 }
 
 // Custom client results
 
+type RaftJoinOptions struct {
+	LeaderAddress    string
+	LeaderCACert     string
+	LeaderClientCert string
+	LeaderClientKey  string
+	LeaderServerName string
+}
+
+type InitOptions struct {
+	SecretShares    int
+	SecretThreshold int
+	StoredShares    int
+	PGPKeys         []string
+	RootTokenPGPKey string
+
+	// AutoUnseal initializes a Vault using a transit or KMS seal, which
+	// generates recovery keys instead of unseal keys
+	AutoUnseal        bool
+	RecoveryShares    int
+	RecoveryThreshold int
+}
+
 type InitState struct {
 	Keys      []string
 	RootToken string
+	Threshold int
+
+	// Fingerprints of the PGP keys used to encrypt each unseal key, aligned with Keys
+	KeyFingerprints []string
+	// Fingerprint of the PGP key used to encrypt the root token
+	RootTokenFingerprint string
+	// RootTokenRevoked records that the root token was revoked after bootstrap and not stored
+	RootTokenRevoked bool
+
+	// EncryptedDataKey is the wrapped key which encrypts the keys and root token at rest
+	EncryptedDataKey string
+	// Generation identifies the write which stored a part of the keys in a distributed storage
+	Generation int64
+
+	// Recovery keys are only returned by Vaults using auto-unseal
+	RecoveryKeys            []string
+	RecoveryThreshold       int
+	RecoveryKeyFingerprints []string
+
+	// Keys replaced by a rekey, kept until the new keys have unsealed Vault
+	BackupKeys            []string
+	BackupThreshold       int
+	BackupKeyFingerprints []string
+}
+
+type RekeyState struct {
+	Nonce             string
+	Started           bool
+	Progress          int
+	Required          int
+	Complete          bool
+	VerificationNonce string
+
+	// Only set once the rekey is complete
+	Keys            []string
+	KeyFingerprints []string
+}
+
+type GenerateRootState struct {
+	Nonce        string
+	Started      bool
+	Progress     int
+	Required     int
+	Complete     bool
+	EncodedToken string
+
+	// Only returned when the attempt is started
+	OTP string
 }
 
 type UnsealState struct {
 	Sealed       bool
 	KeysProvided int
 	KeysRequired int
+	Nonce        string
+}
+
+type SealState struct {
+	Type         string
+	Initialized  bool
+	Sealed       bool
+	Threshold    int
+	Shares       int
+	Progress     int
+	Nonce        string
+	Version      string
+	Migration    bool
+	RecoverySeal bool
 }
 
 type HealthState struct {
-	Active        bool
-	Standby       bool
-	Uninitialized bool
-	Sealed        bool
-	StatusCode    int
+	Active             bool
+	Standby            bool
+	PerformanceStandby bool
+	DRSecondary        bool
+	Uninitialized      bool
+	Sealed             bool
+	StatusCode         int
+
+	// Details holds the parsed sys/health body, empty if Vault did not return one
+	Details HealthResponse
+}
+
+type KeyState struct {
+	Term        int
+	InstallTime time.Time
+	Encryptions int64
 }
@@ -0,0 +1,212 @@
+package vault
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TLSConfig mirrors the TLS settings of the Vault CLI (VAULT_CACERT, VAULT_CAPATH,
+// VAULT_CLIENT_CERT, VAULT_CLIENT_KEY, VAULT_TLS_SERVER_NAME and VAULT_SKIP_VERIFY)
+type TLSConfig struct {
+	CACert     string
+	CAPath     string
+	ClientCert string
+	ClientKey  string
+	ServerName string
+	Insecure   bool
+}
+
+var (
+	ErrInvalidTLSConfig = errors.New("Invalid TLS configuration")
+)
+
+// newTLSClientConfig builds a client configuration which re-reads the CA bundle and
+// client certificate whenever the files change, so that certificates mounted from
+// Kubernetes secrets can be rotated without restarting. The certificate must be
+// issued for the server name if set, and otherwise for the host of the address.
+func newTLSClientConfig(config TLSConfig, address string) (*tls.Config, error) {
+	if (config.ClientCert == "") != (config.ClientKey == "") {
+		return nil, fmt.Errorf("%w: both a client certificate and key must be provided", ErrInvalidTLSConfig)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.ServerName,
+	}
+
+	if config.ClientCert != "" {
+		reloader := &certificateReloader{certFile: config.ClientCert, keyFile: config.ClientKey}
+		if _, err := reloader.GetClientCertificate(nil); err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	}
+
+	if config.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+		return tlsConfig, nil
+	}
+
+	if config.CACert == "" && config.CAPath == "" {
+		// Standard verification against the system roots
+		return tlsConfig, nil
+	}
+
+	reloader := &caReloader{caFile: config.CACert, caPath: config.CAPath}
+	if _, err := reloader.Pool(); err != nil {
+		return nil, err
+	}
+
+	// The SNI sent by crypto/tls is empty for IP addresses, so the expected name
+	// is taken from the address instead
+	serverName := config.ServerName
+	if serverName == "" {
+		parsed, err := url.Parse(address)
+		if err != nil || parsed.Hostname() == "" {
+			return nil, fmt.Errorf("%w: unable to determine the server name of %q", ErrInvalidTLSConfig, address)
+		}
+		serverName = parsed.Hostname()
+	}
+
+	// Verification is performed in VerifyConnection against the current CA pool
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		pool, err := reloader.Pool()
+		if err != nil {
+			return err
+		}
+		return verifyPeer(state, pool, serverName)
+	}
+	return tlsConfig, nil
+}
+
+func verifyPeer(state tls.ConnectionState, pool *x509.CertPool, serverName string) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("Vault did not present a certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range state.PeerCertificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         pool,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	lock        sync.Mutex
+	modified    time.Time
+	certificate *tls.Certificate
+}
+
+func (reloader *certificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	modified, err := latestModTime([]string{reloader.certFile, reloader.keyFile})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read client certificate: %w", err)
+	}
+	if reloader.certificate != nil && modified.Equal(reloader.modified) {
+		return reloader.certificate, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load client certificate: %w", err)
+	}
+	reloader.certificate = &certificate
+	reloader.modified = modified
+	return reloader.certificate, nil
+}
+
+type caReloader struct {
+	caFile string
+	caPath string
+
+	lock     sync.Mutex
+	modified time.Time
+	files    int
+	pool     *x509.CertPool
+}
+
+func (reloader *caReloader) Pool() (*x509.CertPool, error) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	files, err := reloader.caFiles()
+	if err != nil {
+		return nil, err
+	}
+	modified, err := latestModTime(files)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CA certificates: %w", err)
+	}
+	if reloader.pool != nil && modified.Equal(reloader.modified) && len(files) == reloader.files {
+		return reloader.pool, nil
+	}
+
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA certificate: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) && file == reloader.caFile {
+			return nil, fmt.Errorf("%w: no certificates found in %v", ErrInvalidTLSConfig, file)
+		}
+	}
+	reloader.pool = pool
+	reloader.modified = modified
+	reloader.files = len(files)
+	return pool, nil
+}
+
+func (reloader *caReloader) caFiles() ([]string, error) {
+	files := []string{}
+	if reloader.caFile != "" {
+		files = append(files, reloader.caFile)
+	}
+	if reloader.caPath != "" {
+		entries, err := os.ReadDir(reloader.caPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA path: %w", err)
+		}
+		for _, entry := range entries {
+			// Skip the hidden timestamped directories used by Kubernetes volume mounts
+			if entry.IsDir() || entry.Name()[0] == '.' {
+				continue
+			}
+			files = append(files, filepath.Join(reloader.caPath, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+func latestModTime(files []string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,165 @@
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTLSVault(t *testing.T) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeCertificate(t *testing.T, path string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.Nil(t, os.WriteFile(path, data, 0600))
+}
+
+func unrelatedCertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "unrelated"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return der
+}
+
+func TestTLS_VerifiesByDefault(t *testing.T) {
+	server := newTLSVault(t)
+	client, err := NewVaultClient(ClientConfig{Address: server.URL})
+	assert.Nil(t, err)
+
+	_, err = client.HealthCheck(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestTLS_SkipVerify(t *testing.T) {
+	server := newTLSVault(t)
+	client, err := NewVaultClient(ClientConfig{Address: server.URL, TLS: TLSConfig{Insecure: true}})
+	assert.Nil(t, err)
+
+	state, err := client.HealthCheck(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, state.Active)
+}
+
+func TestTLS_CACert(t *testing.T) {
+	server := newTLSVault(t)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeCertificate(t, caFile, server.Certificate().Raw)
+
+	client, err := NewVaultClient(ClientConfig{Address: server.URL, TLS: TLSConfig{CACert: caFile}})
+	assert.Nil(t, err)
+
+	state, err := client.HealthCheck(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, state.Active)
+}
+
+func TestTLS_CAPathReloaded(t *testing.T) {
+	server := newTLSVault(t)
+	caPath := t.TempDir()
+	caFile := filepath.Join(caPath, "ca.crt")
+	writeCertificate(t, caFile, unrelatedCertificate(t))
+
+	client, err := NewVaultClient(ClientConfig{Address: server.URL, TLS: TLSConfig{CAPath: caPath}})
+	assert.Nil(t, err)
+
+	_, err = client.HealthCheck(context.Background())
+	assert.NotNil(t, err)
+
+	// Simulate the secret being rotated
+	writeCertificate(t, caFile, server.Certificate().Raw)
+	future := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(caFile, future, future))
+
+	state, err := client.HealthCheck(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, state.Active)
+}
+
+// newMismatchedTLSVault serves a certificate issued by its own CA for other.example only
+func newMismatchedTLSVault(t *testing.T) (*httptest.Server, []byte) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vault-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.Nil(t, err)
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "other.example"},
+		DNSNames:     []string{"other.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	assert.Nil(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, caDER
+}
+
+func TestTLS_CACertRejectsMismatchedName(t *testing.T) {
+	server, ca := newMismatchedTLSVault(t)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeCertificate(t, caFile, ca)
+
+	client, err := NewVaultClient(ClientConfig{Address: server.URL, TLS: TLSConfig{CACert: caFile}})
+	assert.Nil(t, err)
+	_, err = client.HealthCheck(context.Background())
+	assert.NotNil(t, err)
+
+	client, err = NewVaultClient(ClientConfig{Address: server.URL, TLS: TLSConfig{CACert: caFile, ServerName: "other.example"}})
+	assert.Nil(t, err)
+	state, err := client.HealthCheck(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, state.Active)
+}
+
+func TestTLS_InvalidConfig(t *testing.T) {
+	_, err := NewVaultClient(ClientConfig{Address: "https://127.0.0.1:8200", TLS: TLSConfig{ClientCert: "cert.pem"}})
+	assert.ErrorIs(t, err, ErrInvalidTLSConfig)
+
+	_, err = NewVaultClient(ClientConfig{Address: "https://127.0.0.1:8200", TLS: TLSConfig{CACert: filepath.Join(t.TempDir(), "missing.crt")}})
+	assert.NotNil(t, err)
+}
@@ -2,83 +2,315 @@ package vault
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/pgp"
 )
 
 type Vault interface {
-	HealthCheck() (HealthState, error)
-	Initialize() (InitState, error)
-	Unseal(string) (UnsealState, error)
+	HealthCheck(context.Context) (HealthState, error)
+	Initialize(context.Context, InitOptions) (InitState, error)
+	Unseal(context.Context, string) (UnsealState, error)
+	UnsealMigrate(context.Context, string) (UnsealState, error)
+	ResetUnseal(context.Context) (UnsealState, error)
+	SealStatus(context.Context) (SealState, error)
+	RaftJoin(context.Context, RaftJoinOptions) (bool, error)
+	RekeyInit(context.Context, InitOptions) (RekeyState, error)
+	RekeyUpdate(ctx context.Context, key string, nonce string) (RekeyState, error)
+	RekeyVerify(ctx context.Context, key string, nonce string) (RekeyState, error)
+	RekeyCancel(context.Context) error
+	GenerateRootInit(context.Context) (GenerateRootState, error)
+	GenerateRootUpdate(ctx context.Context, key string, nonce string) (GenerateRootState, error)
+	GenerateRootCancel(context.Context) error
+	RevokeSelf(ctx context.Context, token string) error
+	KeyStatus(ctx context.Context, token string) (KeyState, error)
+	Rotate(ctx context.Context, token string) error
+	Snapshot(ctx context.Context, token string, w io.Writer) error
+	RestoreSnapshot(ctx context.Context, token string, r io.Reader, force bool) error
+	Read(ctx context.Context, token string, path string) (map[string]interface{}, error)
+	Write(ctx context.Context, token string, path string, data map[string]interface{}) (map[string]interface{}, error)
+}
+
+var (
+	ErrInvalidInitOptions = errors.New("Invalid initialization options")
+)
+
+// ClientConfig holds the connection settings of a Vault client
+type ClientConfig struct {
+	Address string
+	TLS     TLSConfig
+
+	// HealthQuery is sent with every health check, e.g. standbyok or perfstandbyok
+	HealthQuery url.Values
+
+	Timeouts Timeouts
+}
+
+// Timeouts bound the duration of each Vault operation. Operations without a
+// specific timeout use Default, and a zero Default means no timeout.
+type Timeouts struct {
+	Default    time.Duration
+	Health     time.Duration
+	Initialize time.Duration
+	Unseal     time.Duration
+	Snapshot   time.Duration
 }
 
 type vaultClient struct {
-	address    string
-	httpClient http.Client
+	address     string
+	healthQuery url.Values
+	timeouts    Timeouts
+	httpClient  http.Client
 }
 
-func NewVaultClient(address string) Vault {
+func NewVaultClient(config ClientConfig) (Vault, error) {
+	tlsClientConfig, err := newTLSClientConfig(config.TLS, config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsClientConfig
+
 	return &vaultClient{
-		address: address,
+		address:     config.Address,
+		healthQuery: config.HealthQuery,
+		timeouts:    config.Timeouts,
 		httpClient: http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			},
+			Transport: transport,
 		},
+	}, nil
+}
+
+// withTimeout bounds the context by the given operation timeout, or the default timeout if unset
+func (vaultClient *vaultClient) withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		timeout = vaultClient.timeouts.Default
+	}
+	if timeout == 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (vaultClient *vaultClient) HealthCheck() (HealthState, error) {
+func (vaultClient *vaultClient) HealthCheck(ctx context.Context) (HealthState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Health)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("%v/v1/sys/health", vaultClient.address)
+	if len(vaultClient.healthQuery) > 0 {
+		endpoint = fmt.Sprintf("%v?%v", endpoint, vaultClient.healthQuery.Encode())
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return HealthState{}, fmt.Errorf("Error creating request: %w", err)
+	}
 
-	response, err := vaultClient.httpClient.Head(endpoint)
+	response, err := vaultClient.httpClient.Do(request)
 	if err != nil {
 		return HealthState{}, err
 	}
 	defer response.Body.Close()
 
+	state := HealthState{StatusCode: response.StatusCode}
+	body, _ := io.ReadAll(response.Body)
+
+	// The status codes can be overridden by the query parameters, so prefer the body when it
+	// is a health response. Errors and proxy responses lack the fields, so fall back to the code.
+	var details HealthResponse
+	var fields struct {
+		Initialized *bool `json:"initialized"`
+		Sealed      *bool `json:"sealed"`
+	}
+	if json.Unmarshal(body, &fields) == nil && fields.Initialized != nil && fields.Sealed != nil && json.Unmarshal(body, &details) == nil {
+		state.Details = details
+		switch true {
+		case !details.Initialized:
+			state.Uninitialized = true
+		case details.Sealed:
+			state.Sealed = true
+		case details.ReplicationDRMode == "secondary":
+			state.DRSecondary = true
+		case details.PerformanceStandby:
+			state.PerformanceStandby = true
+		case details.Standby:
+			state.Standby = true
+		default:
+			state.Active = true
+		}
+		return state, nil
+	}
+
 	switch response.StatusCode {
 	case 200:
-		return HealthState{StatusCode: response.StatusCode, Active: true}, nil
+		state.Active = true
 	case 429:
-		return HealthState{StatusCode: response.StatusCode, Standby: true}, nil
+		state.Standby = true
+	case 472:
+		state.DRSecondary = true
+	case 473:
+		state.PerformanceStandby = true
 	case 501:
-		return HealthState{StatusCode: response.StatusCode, Uninitialized: true}, nil
+		state.Uninitialized = true
 	case 503:
-		return HealthState{StatusCode: response.StatusCode, Sealed: true}, nil
+		state.Sealed = true
 	default:
-		return HealthState{StatusCode: response.StatusCode}, nil
+		return HealthState{}, newAPIError(response, body)
 	}
+	return state, nil
 }
 
-func (vaultClient *vaultClient) Initialize() (InitState, error) {
+func (vaultClient *vaultClient) Initialize(ctx context.Context, options InitOptions) (InitState, error) {
+	if err := options.Validate(); err != nil {
+		return InitState{}, err
+	}
+
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Initialize)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("%v/v1/sys/init", vaultClient.address)
 	request := InitRequest{
-		SecretShares:    5,
-		SecretThreshold: 3,
+		RootTokenPGPKey: options.RootTokenPGPKey,
+	}
+	if options.AutoUnseal {
+		request.RecoveryShares = options.RecoveryShares
+		request.RecoveryThreshold = options.RecoveryThreshold
+		request.RecoveryPGPKeys = options.PGPKeys
+	} else {
+		request.SecretShares = options.SecretShares
+		request.SecretThreshold = options.SecretThreshold
+		request.StoredShares = options.StoredShares
+		request.PGPKeys = options.PGPKeys
 	}
 
 	var response InitResponse
-	if err := vaultRequest[InitRequest, *InitResponse](vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
+	if err := vaultRequest[InitRequest, *InitResponse](ctx, vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
+		return InitState{}, err
+	}
+
+	fingerprints, err := keyFingerprints(options.PGPKeys)
+	if err != nil {
 		return InitState{}, err
 	}
 
-	return InitState{Keys: response.Keys, RootToken: response.RootToken}, nil
+	state := InitState{RootToken: response.RootToken}
+	if options.AutoUnseal {
+		state.RecoveryKeys = response.RecoveryKeys
+		state.RecoveryThreshold = options.RecoveryThreshold
+		state.RecoveryKeyFingerprints = fingerprints
+	} else {
+		state.Keys = response.Keys
+		state.Threshold = options.SecretThreshold
+		state.KeyFingerprints = fingerprints
+	}
+
+	// Encrypted keys are returned as base64 ciphertext, matching the Vault CLI output
+	if len(fingerprints) > 0 {
+		if options.AutoUnseal {
+			state.RecoveryKeys = response.RecoveryKeysBase64
+		} else {
+			state.Keys = response.KeysBase64
+		}
+	}
+	if options.RootTokenPGPKey != "" {
+		fingerprint, err := pgp.Fingerprint(options.RootTokenPGPKey)
+		if err != nil {
+			return InitState{}, err
+		}
+		state.RootTokenFingerprint = fingerprint
+	}
+
+	return state, nil
 }
 
-func (vaultClient *vaultClient) Unseal(key string) (UnsealState, error) {
-	endpoint := fmt.Sprintf("%v/v1/sys/unseal", vaultClient.address)
-	request := UnsealRequest{
-		Key: key,
+func keyFingerprints(keys []string) ([]string, error) {
+	var fingerprints []string
+	for _, key := range keys {
+		fingerprint, err := pgp.Fingerprint(key)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints, nil
+}
+
+// Validate checks the share configuration against the constraints enforced by Vault
+func (options InitOptions) Validate() error {
+	if options.AutoUnseal {
+		if err := validateShares("recovery", options.RecoveryShares, options.RecoveryThreshold); err != nil {
+			return err
+		}
+		if len(options.PGPKeys) > 0 && len(options.PGPKeys) != options.RecoveryShares {
+			return fmt.Errorf("%w: %d PGP keys provided for %d recovery shares", ErrInvalidInitOptions, len(options.PGPKeys), options.RecoveryShares)
+		}
+		return nil
+	}
+
+	if err := validateShares("secret", options.SecretShares, options.SecretThreshold); err != nil {
+		return err
+	}
+	if options.StoredShares < 0 || options.StoredShares > options.SecretShares {
+		return fmt.Errorf("%w: stored shares must be between 0 and %d", ErrInvalidInitOptions, options.SecretShares)
+	}
+	if len(options.PGPKeys) > 0 && len(options.PGPKeys) != options.SecretShares {
+		return fmt.Errorf("%w: %d PGP keys provided for %d secret shares", ErrInvalidInitOptions, len(options.PGPKeys), options.SecretShares)
+	}
+	return nil
+}
+
+func validateShares(kind string, shares int, threshold int) error {
+	if shares < 1 {
+		return fmt.Errorf("%w: %v shares must be at least 1", ErrInvalidInitOptions, kind)
+	}
+	if threshold < 1 || threshold > shares {
+		return fmt.Errorf("%w: %v threshold must be between 1 and %d", ErrInvalidInitOptions, kind, shares)
+	}
+	if shares > 1 && threshold == 1 {
+		return fmt.Errorf("%w: %v threshold must be greater than 1 when using multiple shares", ErrInvalidInitOptions, kind)
 	}
+	return nil
+}
+
+func (vaultClient *vaultClient) Unseal(ctx context.Context, key string) (UnsealState, error) {
+	return vaultClient.unseal(ctx, UnsealRequest{
+		Key: key,
+	})
+}
+
+// UnsealMigrate submits an unseal key while a seal migration is in progress
+func (vaultClient *vaultClient) UnsealMigrate(ctx context.Context, key string) (UnsealState, error) {
+	return vaultClient.unseal(ctx, UnsealRequest{
+		Key:     key,
+		Migrate: true,
+	})
+}
+
+// ResetUnseal discards any unseal keys submitted so far
+func (vaultClient *vaultClient) ResetUnseal(ctx context.Context) (UnsealState, error) {
+	return vaultClient.unseal(ctx, UnsealRequest{
+		Reset: true,
+	})
+}
+
+func (vaultClient *vaultClient) unseal(ctx context.Context, request UnsealRequest) (UnsealState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Unseal)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/unseal", vaultClient.address)
 
 	var response UnsealResponse
-	if err := vaultRequest[UnsealRequest, *UnsealResponse](vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
+	if err := vaultRequest[UnsealRequest, *UnsealResponse](ctx, vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
 		return UnsealState{}, err
 	}
 
@@ -94,17 +326,337 @@ func (vaultClient *vaultClient) Unseal(key string) (UnsealState, error) {
 		Sealed:       response.Sealed,
 		KeysProvided: progress,
 		KeysRequired: target,
+		Nonce:        response.Nonce,
+	}, nil
+}
+
+func (vaultClient *vaultClient) SealStatus(ctx context.Context) (SealState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Health)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/seal-status", vaultClient.address)
+
+	var response SealStatusResponse
+	if err := vaultRequest[any, *SealStatusResponse](ctx, vaultClient, http.MethodGet, endpoint, nil, &response); err != nil {
+		return SealState{}, err
+	}
+
+	return SealState{
+		Type:         response.Type,
+		Initialized:  response.Initialized,
+		Sealed:       response.Sealed,
+		Threshold:    response.T,
+		Shares:       response.N,
+		Progress:     response.Progress,
+		Nonce:        response.Nonce,
+		Version:      response.Version,
+		Migration:    response.Migration,
+		RecoverySeal: response.RecoverySeal,
+	}, nil
+}
+
+// RaftJoin asks an uninitialized integrated storage node to join the cluster led by the given leader
+func (vaultClient *vaultClient) RaftJoin(ctx context.Context, options RaftJoinOptions) (bool, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/storage/raft/join", vaultClient.address)
+	request := RaftJoinRequest{
+		LeaderAPIAddr:       options.LeaderAddress,
+		LeaderCACert:        options.LeaderCACert,
+		LeaderClientCert:    options.LeaderClientCert,
+		LeaderClientKey:     options.LeaderClientKey,
+		LeaderTLSServerName: options.LeaderServerName,
+	}
+
+	var response RaftJoinResponse
+	if err := vaultRequest[RaftJoinRequest, *RaftJoinResponse](ctx, vaultClient, http.MethodPost, endpoint, request, &response); err != nil {
+		return false, err
+	}
+	return response.Joined, nil
+}
+
+// RekeyInit starts rotating the unseal keys. Verification is always required so
+// that the new keys are proven to work before the old ones stop working.
+func (vaultClient *vaultClient) RekeyInit(ctx context.Context, options InitOptions) (RekeyState, error) {
+	if err := options.Validate(); err != nil {
+		return RekeyState{}, err
+	}
+
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/rekey/init", vaultClient.address)
+	request := RekeyInitRequest{
+		SecretShares:        options.SecretShares,
+		SecretThreshold:     options.SecretThreshold,
+		PGPKeys:             options.PGPKeys,
+		RequireVerification: true,
+	}
+
+	var response RekeyResponse
+	if err := vaultRequest[RekeyInitRequest, *RekeyResponse](ctx, vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
+		return RekeyState{}, err
+	}
+	return RekeyState{
+		Nonce:    response.Nonce,
+		Started:  response.Started,
+		Progress: response.Progress,
+		Required: response.Required,
 	}, nil
 }
 
-func vaultRequest[K any, V any](client *vaultClient, method string, endpoint string, body K, response V) error {
+// RekeyUpdate submits one of the current unseal keys. Once enough keys have been
+// provided the new keys are returned, encrypted if PGP keys were given to RekeyInit.
+func (vaultClient *vaultClient) RekeyUpdate(ctx context.Context, key string, nonce string) (RekeyState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Unseal)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/rekey/update", vaultClient.address)
+	request := RekeyUpdateRequest{Key: key, Nonce: nonce}
+
+	var response RekeyResponse
+	if err := vaultRequest[RekeyUpdateRequest, *RekeyResponse](ctx, vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
+		return RekeyState{}, err
+	}
+
+	state := RekeyState{
+		Nonce:             response.Nonce,
+		Started:           response.Started,
+		Progress:          response.Progress,
+		Required:          response.Required,
+		Complete:          response.Complete,
+		VerificationNonce: response.VerificationNonce,
+		Keys:              response.Keys,
+	}
+
+	// Mirror Initialize: encrypted keys are kept as base64 ciphertext
+	if len(response.PGPFingerprints) > 0 {
+		state.Keys = response.KeysBase64
+		state.KeyFingerprints = response.PGPFingerprints
+	}
+	return state, nil
+}
+
+// RekeyVerify submits one of the new unseal keys to prove they work
+func (vaultClient *vaultClient) RekeyVerify(ctx context.Context, key string, nonce string) (RekeyState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Unseal)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/rekey/verify", vaultClient.address)
+	request := RekeyUpdateRequest{Key: key, Nonce: nonce}
+
+	var response RekeyResponse
+	if err := vaultRequest[RekeyUpdateRequest, *RekeyResponse](ctx, vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
+		return RekeyState{}, err
+	}
+	return RekeyState{
+		Nonce:    response.Nonce,
+		Started:  response.Started,
+		Progress: response.Progress,
+		Required: response.T,
+		Complete: response.Complete,
+	}, nil
+}
+
+// RekeyCancel aborts a rekey in progress, leaving the current keys in place
+func (vaultClient *vaultClient) RekeyCancel(ctx context.Context) error {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/rekey/init", vaultClient.address)
+	return vaultRequest[any, *struct{}](ctx, vaultClient, http.MethodDelete, endpoint, nil, nil)
+}
+
+// GenerateRootInit starts a root token generation attempt, returning the one time
+// password needed to decode the resulting token
+func (vaultClient *vaultClient) GenerateRootInit(ctx context.Context) (GenerateRootState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/generate-root/attempt", vaultClient.address)
+
+	var response GenerateRootResponse
+	if err := vaultRequest[struct{}, *GenerateRootResponse](ctx, vaultClient, http.MethodPut, endpoint, struct{}{}, &response); err != nil {
+		return GenerateRootState{}, err
+	}
+	if response.OTPLength == 0 || response.OTP == "" {
+		return GenerateRootState{}, fmt.Errorf("Vault did not return a one time password")
+	}
+	return generateRootState(response), nil
+}
+
+// GenerateRootUpdate submits an unseal key (or recovery key) to the current attempt
+func (vaultClient *vaultClient) GenerateRootUpdate(ctx context.Context, key string, nonce string) (GenerateRootState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Unseal)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/generate-root/update", vaultClient.address)
+	request := GenerateRootUpdateRequest{Key: key, Nonce: nonce}
+
+	var response GenerateRootResponse
+	if err := vaultRequest[GenerateRootUpdateRequest, *GenerateRootResponse](ctx, vaultClient, http.MethodPut, endpoint, request, &response); err != nil {
+		return GenerateRootState{}, err
+	}
+	return generateRootState(response), nil
+}
+
+// GenerateRootCancel aborts the current root token generation attempt
+func (vaultClient *vaultClient) GenerateRootCancel(ctx context.Context) error {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/generate-root/attempt", vaultClient.address)
+	return vaultRequest[any, *struct{}](ctx, vaultClient, http.MethodDelete, endpoint, nil, nil)
+}
+
+// RevokeSelf revokes the given token, used to discard the root token once it is no longer needed
+func (vaultClient *vaultClient) RevokeSelf(ctx context.Context, token string) error {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/auth/token/revoke-self", vaultClient.address)
+	return vaultRequest[any, *struct{}](withToken(ctx, token), vaultClient, http.MethodPost, endpoint, nil, nil)
+}
+
+// KeyStatus returns the term and install time of the current barrier encryption key
+func (vaultClient *vaultClient) KeyStatus(ctx context.Context, token string) (KeyState, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/key-status", vaultClient.address)
+
+	var response KeyStatusResponse
+	if err := vaultRequest[any, *KeyStatusResponse](withToken(ctx, token), vaultClient, http.MethodGet, endpoint, nil, &response); err != nil {
+		return KeyState{}, err
+	}
+	return KeyState{
+		Term:        response.Term,
+		InstallTime: response.InstallTime,
+		Encryptions: response.Encryptions,
+	}, nil
+}
+
+// Rotate installs a new barrier encryption key
+func (vaultClient *vaultClient) Rotate(ctx context.Context, token string) error {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/rotate", vaultClient.address)
+	return vaultRequest[any, *struct{}](withToken(ctx, token), vaultClient, http.MethodPost, endpoint, nil, nil)
+}
+
+// Snapshot streams a Raft snapshot of the integrated storage to the writer
+func (vaultClient *vaultClient) Snapshot(ctx context.Context, token string, w io.Writer) error {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Snapshot)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/storage/raft/snapshot", vaultClient.address)
+
+	body, err := streamRequest(withToken(ctx, token), vaultClient, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(w, body); err != nil {
+		return fmt.Errorf("Failed to read snapshot: %w", err)
+	}
+	return nil
+}
+
+// RestoreSnapshot installs a Raft snapshot. Snapshots taken from a different
+// cluster, or with different keys, must be forced.
+func (vaultClient *vaultClient) RestoreSnapshot(ctx context.Context, token string, r io.Reader, force bool) error {
+	ctx, cancel := vaultClient.withTimeout(ctx, vaultClient.timeouts.Snapshot)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/sys/storage/raft/snapshot", vaultClient.address)
+	if force {
+		endpoint = fmt.Sprintf("%v/v1/sys/storage/raft/snapshot-force", vaultClient.address)
+	}
+
+	body, err := streamRequest(withToken(ctx, token), vaultClient, http.MethodPost, endpoint, r)
+	if err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+// Read returns the data of an authenticated GET request to the given API path, e.g. "sys/mounts"
+func (vaultClient *vaultClient) Read(ctx context.Context, token string, path string) (map[string]interface{}, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/%v", vaultClient.address, strings.TrimPrefix(path, "/"))
+
+	var response DataResponse
+	if err := vaultRequest[any, *DataResponse](withToken(ctx, token), vaultClient, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Data, nil
+}
+
+// Write sends an authenticated POST request to the given API path, returning the response data if there is any
+func (vaultClient *vaultClient) Write(ctx context.Context, token string, path string, data map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := vaultClient.withTimeout(ctx, 0)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%v/v1/%v", vaultClient.address, strings.TrimPrefix(path, "/"))
+
+	var response DataResponse
+	if err := vaultRequest[map[string]interface{}, *DataResponse](withToken(ctx, token), vaultClient, http.MethodPost, endpoint, data, &response); err != nil {
+		return nil, err
+	}
+	return response.Data, nil
+}
+
+func generateRootState(response GenerateRootResponse) GenerateRootState {
+	return GenerateRootState{
+		Nonce:        response.Nonce,
+		Started:      response.Started,
+		Progress:     response.Progress,
+		Required:     response.Required,
+		Complete:     response.Complete,
+		EncodedToken: response.EncodedToken,
+		OTP:          response.OTP,
+	}
+}
+
+// DecodeRootToken recovers the root token from the encoded token and the one time password of the attempt
+func DecodeRootToken(encodedToken string, otp string) (string, error) {
+	tokenBytes, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encodedToken, "="))
+	if err != nil {
+		return "", fmt.Errorf("Invalid encoded token: %w", err)
+	}
+	if len(tokenBytes) != len(otp) {
+		return "", fmt.Errorf("Encoded token length %d does not match the one time password length %d", len(tokenBytes), len(otp))
+	}
+
+	for index := range tokenBytes {
+		tokenBytes[index] ^= otp[index]
+	}
+	return string(tokenBytes), nil
+}
+
+type tokenKey struct{}
+
+// withToken attaches a Vault token to the requests made with the context
+func withToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+func vaultRequest[K any, V any](ctx context.Context, client *vaultClient, method string, endpoint string, body K, response V) error {
 	requestData, _ := json.Marshal(&body)
 	requestBytes := bytes.NewReader(requestData)
 
-	request, err := http.NewRequest(method, endpoint, requestBytes)
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, requestBytes)
 	if err != nil {
 		return fmt.Errorf("Error creating request: %w", err)
 	}
+	if token, ok := ctx.Value(tokenKey{}).(string); ok && token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
 
 	httpResponse, err := client.httpClient.Do(request)
 	if err != nil {
@@ -117,8 +669,13 @@ func vaultRequest[K any, V any](client *vaultClient, method string, endpoint str
 		return fmt.Errorf("Error reading Vault response: %w", err)
 	}
 
-	if httpResponse.StatusCode != 200 {
-		return fmt.Errorf("Vault operation failed [%d]: %w", httpResponse.StatusCode, err)
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		return newAPIError(httpResponse, httpResponseBody)
+	}
+
+	// Some endpoints respond with 204 No Content
+	if len(httpResponseBody) == 0 {
+		return nil
 	}
 
 	if err := json.Unmarshal(httpResponseBody, &response); err != nil {
@@ -127,3 +684,36 @@ func vaultRequest[K any, V any](client *vaultClient, method string, endpoint str
 
 	return nil
 }
+
+// streamRequest sends a request with a raw body, returning the raw response body
+// for the caller to close
+func streamRequest(ctx context.Context, client *vaultClient, method string, endpoint string, body io.Reader) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating request: %w", err)
+	}
+	if token, ok := ctx.Value(tokenKey{}).(string); ok && token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
+
+	httpResponse, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("Response error: %w", err)
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		defer httpResponse.Body.Close()
+		httpResponseBody, _ := io.ReadAll(httpResponse.Body)
+		return nil, newAPIError(httpResponse, httpResponseBody)
+	}
+	return httpResponse.Body, nil
+}
+
+func newAPIError(httpResponse *http.Response, body []byte) *APIError {
+	var errorResponse ErrorResponse
+	json.Unmarshal(body, &errorResponse)
+	return &APIError{
+		StatusCode: httpResponse.StatusCode,
+		Errors:     errorResponse.Errors,
+		Endpoint:   httpResponse.Request.URL.Path,
+	}
+}
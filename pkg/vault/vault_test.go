@@ -0,0 +1,336 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTransitSealedVault starts a fake Vault which behaves like a server
+// configured with a transit seal: it only accepts recovery parameters on
+// init and refuses unseal keys
+func newTransitSealedVault(t *testing.T) (*httptest.Server, *InitRequest) {
+	received := &InitRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/sys/init":
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(received))
+			if received.SecretShares != 0 || received.RecoveryShares == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":["parameters secret_shares,secret_threshold not applicable to seal type transit"]}`))
+				return
+			}
+			json.NewEncoder(w).Encode(InitResponse{
+				Keys:               []string{},
+				KeysBase64:         []string{},
+				RecoveryKeys:       []string{"r1", "r2", "r3"},
+				RecoveryKeysBase64: []string{"cjE=", "cjI=", "cjM="},
+				RootToken:          "root",
+			})
+		case "/v1/sys/unseal":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":["Vault is using auto-unseal"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func TestInitialize_AutoUnseal(t *testing.T) {
+	server, received := newTransitSealedVault(t)
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	state, err := client.Initialize(context.Background(), InitOptions{AutoUnseal: true, RecoveryShares: 3, RecoveryThreshold: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, received.RecoveryShares)
+	assert.Equal(t, 2, received.RecoveryThreshold)
+	assert.Equal(t, []string{"r1", "r2", "r3"}, state.RecoveryKeys)
+	assert.Equal(t, 2, state.RecoveryThreshold)
+	assert.Equal(t, "root", state.RootToken)
+	assert.Empty(t, state.Keys)
+}
+
+func TestInitialize_ShamirAgainstAutoUnseal(t *testing.T) {
+	server, _ := newTransitSealedVault(t)
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	_, err := client.Initialize(context.Background(), InitOptions{SecretShares: 5, SecretThreshold: 3})
+	assert.NotNil(t, err)
+}
+
+func TestInitialize_InvalidOptions(t *testing.T) {
+	client, _ := NewVaultClient(ClientConfig{Address: "http://127.0.0.1:0"})
+
+	_, err := client.Initialize(context.Background(), InitOptions{AutoUnseal: true, RecoveryShares: 3, RecoveryThreshold: 4})
+	assert.ErrorIs(t, err, ErrInvalidInitOptions)
+
+	_, err = client.Initialize(context.Background(), InitOptions{SecretShares: 3, SecretThreshold: 1})
+	assert.ErrorIs(t, err, ErrInvalidInitOptions)
+}
+
+func TestRaftJoin(t *testing.T) {
+	var received RaftJoinRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sys/storage/raft/join", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Write([]byte(`{"joined":true}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	joined, err := client.RaftJoin(context.Background(), RaftJoinOptions{LeaderAddress: "https://vault-0:8200", LeaderCACert: "ca"})
+	assert.Nil(t, err)
+	assert.True(t, joined)
+	assert.Equal(t, RaftJoinRequest{LeaderAPIAddr: "https://vault-0:8200", LeaderCACert: "ca"}, received)
+}
+
+func TestHealthCheck_ParsesBody(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		query = r.URL.Query()
+		w.WriteHeader(473)
+		w.Write([]byte(`{"initialized":true,"sealed":false,"standby":true,"performance_standby":true,
+			"replication_performance_mode":"disabled","replication_dr_mode":"disabled",
+			"server_time_utc":1700000000,"version":"1.15.0","cluster_name":"vault-cluster","cluster_id":"abc"}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL, HealthQuery: url.Values{"perfstandbyok": {"true"}}})
+
+	state, err := client.HealthCheck(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "true", query.Get("perfstandbyok"))
+	assert.True(t, state.PerformanceStandby)
+	assert.False(t, state.Standby)
+	assert.Equal(t, 473, state.StatusCode)
+	assert.Equal(t, "1.15.0", state.Details.Version)
+	assert.Equal(t, "abc", state.Details.ClusterID)
+	assert.Equal(t, int64(1700000000), state.Details.ServerTimeUTC)
+}
+
+func TestHealthCheck_OverriddenStatusCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"initialized":true,"sealed":false,"standby":false,"replication_dr_mode":"secondary"}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	state, err := client.HealthCheck(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, state.DRSecondary)
+	assert.False(t, state.Active)
+}
+
+func TestHealthCheck_StatusCodeWithoutBody(t *testing.T) {
+	codes := map[int]func(HealthState) bool{
+		200: func(s HealthState) bool { return s.Active },
+		429: func(s HealthState) bool { return s.Standby },
+		472: func(s HealthState) bool { return s.DRSecondary },
+		473: func(s HealthState) bool { return s.PerformanceStandby },
+		501: func(s HealthState) bool { return s.Uninitialized },
+		503: func(s HealthState) bool { return s.Sealed },
+	}
+	for code, check := range codes {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+		state, err := client.HealthCheck(context.Background())
+		assert.Nil(t, err)
+		assert.True(t, check(state), "status code %d", code)
+		server.Close()
+	}
+}
+
+func TestHealthCheck_IgnoresNonHealthBody(t *testing.T) {
+	for code, body := range map[int]string{500: `{"errors":["internal error"]}`, 502: `{}`} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+			w.Write([]byte(body))
+		}))
+		client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+		state, err := client.HealthCheck(context.Background())
+		assert.NotNil(t, err, "status code %d", code)
+		assert.False(t, state.Uninitialized, "status code %d", code)
+		server.Close()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+	state, err := client.HealthCheck(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, state.Sealed)
+	assert.False(t, state.Uninitialized)
+}
+
+func TestSealStatusAndReset(t *testing.T) {
+	var received UnsealRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/sys/seal-status":
+			w.Write([]byte(`{"type":"shamir","initialized":true,"sealed":true,"t":3,"n":5,"progress":2,"nonce":"abc","version":"1.15.0"}`))
+		case "/v1/sys/unseal":
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+			w.Write([]byte(`{"sealed":true,"t":3,"n":5,"progress":0,"nonce":""}`))
+		}
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	status, err := client.SealStatus(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, SealState{Type: "shamir", Initialized: true, Sealed: true, Threshold: 3, Shares: 5, Progress: 2, Nonce: "abc", Version: "1.15.0"}, status)
+
+	state, err := client.ResetUnseal(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, received.Reset)
+	assert.Equal(t, 0, state.KeysProvided)
+}
+
+func TestClient_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL, Timeouts: Timeouts{Default: time.Minute, Health: 50 * time.Millisecond}})
+
+	_, err := client.HealthCheck(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClient_Cancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := client.Unseal(ctx, "key")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDecodeRootToken(t *testing.T) {
+	token, otp := "hvs.exampletoken", "0123456789abcdef"
+	encoded := make([]byte, len(token))
+	for index := range encoded {
+		encoded[index] = token[index] ^ otp[index]
+	}
+
+	decoded, err := DecodeRootToken(base64.RawStdEncoding.EncodeToString(encoded), otp)
+	assert.Nil(t, err)
+	assert.Equal(t, token, decoded)
+
+	_, err = DecodeRootToken(base64.RawStdEncoding.EncodeToString(encoded), "short")
+	assert.NotNil(t, err)
+}
+
+func TestRevokeSelf_SendsToken(t *testing.T) {
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/auth/token/revoke-self", r.URL.Path)
+		token = r.Header.Get("X-Vault-Token")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	assert.Nil(t, client.RevokeSelf(context.Background(), "root"))
+	assert.Equal(t, "root", token)
+}
+
+func TestWrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sys/policies/acl/reader", r.URL.Path)
+		assert.Equal(t, "root", r.Header.Get("X-Vault-Token"))
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "policy", body["policy"])
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	_, err := client.Write(context.Background(), "root", "sys/policies/acl/reader", map[string]interface{}{"policy": "policy"})
+	assert.Nil(t, err)
+}
+
+func TestRead_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	_, err := client.Read(context.Background(), "root", "sys/policies/acl/missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestUnsealMigrate_SendsMigrateFlag(t *testing.T) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"sealed":false,"t":1,"n":1,"progress":0}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	_, err := client.UnsealMigrate(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, true, request["migrate"])
+	assert.Equal(t, "key", request["key"])
+}
+
+func TestSnapshot_Streams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sys/storage/raft/snapshot", r.URL.Path)
+		assert.Equal(t, "root", r.Header.Get("X-Vault-Token"))
+		w.Write([]byte("snapshot data"))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	var snapshot bytes.Buffer
+	assert.Nil(t, client.Snapshot(context.Background(), "root", &snapshot))
+	assert.Equal(t, "snapshot data", snapshot.String())
+}
+
+func TestRestoreSnapshot_Force(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sys/storage/raft/snapshot-force", r.URL.Path)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":["invalid snapshot"]}`))
+	}))
+	defer server.Close()
+	client, _ := NewVaultClient(ClientConfig{Address: server.URL})
+
+	err := client.RestoreSnapshot(context.Background(), "root", strings.NewReader("snapshot data"), true)
+	var apiError *APIError
+	assert.ErrorAs(t, err, &apiError)
+	assert.Equal(t, []string{"invalid snapshot"}, apiError.Errors)
+}
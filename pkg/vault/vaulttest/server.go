@@ -0,0 +1,370 @@
+// Package vaulttest provides an in-process fake Vault server for tests. It
+// implements sys/health, sys/init, sys/unseal, sys/seal-status and sys/seal
+// for a Shamir sealed Vault, with faults that can be injected at runtime.
+package vaulttest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	VERSION = "1.15.0"
+)
+
+type failure struct {
+	remaining  int
+	statusCode int
+}
+
+// Server is a fake Vault. Unseal keys are only checked once the threshold is
+// reached, like a real Vault, so a wrong key discards the progress made so far.
+type Server struct {
+	*httptest.Server
+
+	lock        sync.Mutex
+	initialized bool
+	sealed      bool
+	threshold   int
+	keys        []string
+	rootToken   string
+	progress    []string
+	nonce       string
+	clusterID   string
+
+	latency  time.Duration
+	failures map[string]*failure
+	rejected map[string]bool
+	requests map[string]int
+}
+
+// NewServer starts an uninitialized, sealed Vault
+func NewServer() *Server {
+	server := &Server{
+		sealed:    true,
+		clusterID: randomHex(16),
+		failures:  map[string]*failure{},
+		rejected:  map[string]bool{},
+		requests:  map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/sys/health", server.handleHealth)
+	mux.HandleFunc("/v1/sys/init", server.handleInit)
+	mux.HandleFunc("/v1/sys/unseal", server.handleUnseal)
+	mux.HandleFunc("/v1/sys/seal-status", server.handleSealStatus)
+	mux.HandleFunc("/v1/sys/seal", server.handleSeal)
+	server.Server = httptest.NewServer(server.inject(mux))
+	return server
+}
+
+// SetLatency delays every response, honouring the request context
+func (server *Server) SetLatency(latency time.Duration) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.latency = latency
+}
+
+// FailRequests makes the next count requests to the path, e.g. "/v1/sys/unseal", fail with the status code
+func (server *Server) FailRequests(path string, count int, statusCode int) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.failures[path] = &failure{remaining: count, statusCode: statusCode}
+}
+
+// RejectKey makes Vault treat a valid unseal key as wrong
+func (server *Server) RejectKey(key string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.rejected[key] = true
+}
+
+// Restart simulates the Vault process restarting, which seals it and discards any unseal progress
+func (server *Server) Restart() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.sealed = true
+	server.progress = nil
+	server.nonce = ""
+}
+
+func (server *Server) Initialized() bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.initialized
+}
+
+func (server *Server) Sealed() bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.sealed
+}
+
+// Keys returns the hex encoded unseal keys generated by sys/init
+func (server *Server) Keys() []string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]string{}, server.keys...)
+}
+
+func (server *Server) RootToken() string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.rootToken
+}
+
+// Progress returns the number of unseal keys submitted towards the threshold
+func (server *Server) Progress() int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return len(server.progress)
+}
+
+// Requests returns the number of requests received for the path
+func (server *Server) Requests(path string) int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.requests[path]
+}
+
+// inject applies the configured latency and failures before handling a request
+func (server *Server) inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.lock.Lock()
+		server.requests[r.URL.Path]++
+		latency := server.latency
+		var statusCode int
+		if failure, ok := server.failures[r.URL.Path]; ok && failure.remaining > 0 {
+			failure.remaining--
+			statusCode = failure.statusCode
+		}
+		server.lock.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(latency):
+			}
+		}
+		if statusCode != 0 {
+			writeErrors(w, statusCode, "injected failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (server *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	statusCode := http.StatusOK
+	if !server.initialized {
+		statusCode = http.StatusNotImplemented
+	} else if server.sealed {
+		statusCode = http.StatusServiceUnavailable
+	}
+	writeJSON(w, statusCode, vault.HealthResponse{
+		Initialized:   server.initialized,
+		Sealed:        server.sealed,
+		ServerTimeUTC: time.Now().Unix(),
+		Version:       VERSION,
+		ClusterName:   "vault-cluster-test",
+		ClusterID:     server.clusterID,
+	})
+}
+
+func (server *Server) handleInit(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]bool{"initialized": server.initialized})
+		return
+	}
+
+	var request vault.InitRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if server.initialized {
+		writeErrors(w, http.StatusBadRequest, "Vault is already initialized")
+		return
+	}
+	if request.SecretShares < 1 || request.SecretThreshold < 1 || request.SecretThreshold > request.SecretShares {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid seal configuration: threshold %d and shares %d", request.SecretThreshold, request.SecretShares))
+		return
+	}
+
+	response := vault.InitResponse{RootToken: "hvs." + randomHex(12)}
+	for i := 0; i < request.SecretShares; i++ {
+		key := randomHex(32)
+		keyBytes, _ := hex.DecodeString(key)
+		response.Keys = append(response.Keys, key)
+		response.KeysBase64 = append(response.KeysBase64, base64.StdEncoding.EncodeToString(keyBytes))
+	}
+
+	server.initialized = true
+	server.sealed = true
+	server.threshold = request.SecretThreshold
+	server.keys = response.Keys
+	server.rootToken = response.RootToken
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (server *Server) handleUnseal(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	var request vault.UnsealRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !server.initialized {
+		writeErrors(w, http.StatusBadRequest, "Vault is not initialized")
+		return
+	}
+
+	if request.Reset {
+		server.progress = nil
+		server.nonce = ""
+		writeJSON(w, http.StatusOK, server.unsealResponse())
+		return
+	}
+	if !server.sealed {
+		writeJSON(w, http.StatusOK, server.unsealResponse())
+		return
+	}
+
+	key, ok := server.decodeKey(request.Key)
+	if !ok {
+		writeErrors(w, http.StatusBadRequest, "'key' must be a valid hex or base64 string")
+		return
+	}
+	for _, submitted := range server.progress {
+		if submitted == key {
+			// Duplicate keys do not count towards the threshold
+			writeJSON(w, http.StatusOK, server.unsealResponse())
+			return
+		}
+	}
+	if server.nonce == "" {
+		server.nonce = randomHex(16)
+	}
+	server.progress = append(server.progress, key)
+
+	if len(server.progress) < server.threshold {
+		writeJSON(w, http.StatusOK, server.unsealResponse())
+		return
+	}
+
+	// The shares are only combined, and so verified, once the threshold is reached
+	valid := true
+	for _, submitted := range server.progress {
+		if !server.isValidKey(submitted) {
+			valid = false
+		}
+	}
+	server.progress = nil
+	server.nonce = ""
+	if !valid {
+		writeErrors(w, http.StatusBadRequest, "failed to unseal: cipher: message authentication failed")
+		return
+	}
+	server.sealed = false
+	writeJSON(w, http.StatusOK, server.unsealResponse())
+}
+
+func (server *Server) handleSealStatus(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, vault.SealStatusResponse{
+		Type:        "shamir",
+		Initialized: server.initialized,
+		Sealed:      server.sealed,
+		T:           server.threshold,
+		N:           len(server.keys),
+		Progress:    len(server.progress),
+		Nonce:       server.nonce,
+		Version:     VERSION,
+		StorageType: "inmem",
+	})
+}
+
+func (server *Server) handleSeal(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if server.sealed {
+		writeErrors(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != server.rootToken {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	server.sealed = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) unsealResponse() vault.UnsealResponse {
+	return vault.UnsealResponse{
+		Sealed:   server.sealed,
+		T:        server.threshold,
+		N:        len(server.keys),
+		Progress: len(server.progress),
+		Nonce:    server.nonce,
+	}
+}
+
+// decodeKey normalizes a hex or base64 key to hex
+func (server *Server) decodeKey(key string) (string, bool) {
+	if keyBytes, err := hex.DecodeString(key); err == nil && len(keyBytes) > 0 {
+		return hex.EncodeToString(keyBytes), true
+	}
+	if keyBytes, err := base64.StdEncoding.DecodeString(key); err == nil && len(keyBytes) > 0 {
+		return hex.EncodeToString(keyBytes), true
+	}
+	return "", false
+}
+
+func (server *Server) isValidKey(key string) bool {
+	if server.rejected[key] {
+		return false
+	}
+	for _, valid := range server.keys {
+		if valid == key {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeErrors(w http.ResponseWriter, statusCode int, errors ...string) {
+	writeJSON(w, statusCode, vault.ErrorResponse{Errors: errors})
+}
+
+func randomHex(length int) string {
+	data := make([]byte, length)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
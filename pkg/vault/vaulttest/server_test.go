@@ -0,0 +1,93 @@
+package vaulttest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func newInitializedServer(t *testing.T, shares int, threshold int) (*Server, vault.Vault) {
+	server := NewServer()
+	t.Cleanup(server.Close)
+	client, _ := vault.NewVaultClient(vault.ClientConfig{Address: server.URL})
+	_, err := client.Initialize(context.Background(), vault.InitOptions{SecretShares: shares, SecretThreshold: threshold})
+	assert.Nil(t, err)
+	return server, client
+}
+
+func TestServer_InitializeAndUnseal(t *testing.T) {
+	server, client := newInitializedServer(t, 3, 2)
+	keys := server.Keys()
+
+	state, _ := client.HealthCheck(context.Background())
+	assert.True(t, state.Sealed)
+
+	unseal, err := client.Unseal(context.Background(), keys[0])
+	assert.Nil(t, err)
+	assert.Equal(t, vault.UnsealState{Sealed: true, KeysProvided: 1, KeysRequired: 2, Nonce: unseal.Nonce}, unseal)
+	unseal, err = client.Unseal(context.Background(), keys[2])
+	assert.Nil(t, err)
+	assert.False(t, unseal.Sealed)
+
+	state, _ = client.HealthCheck(context.Background())
+	assert.True(t, state.Active)
+	_, err = client.Initialize(context.Background(), vault.InitOptions{SecretShares: 1, SecretThreshold: 1})
+	assert.ErrorIs(t, err, vault.ErrAlreadyInitialized)
+}
+
+func TestServer_WrongKeyResetsProgress(t *testing.T) {
+	server, client := newInitializedServer(t, 3, 2)
+	keys := server.Keys()
+	server.RejectKey(keys[1])
+
+	client.Unseal(context.Background(), keys[0])
+	_, err := client.Unseal(context.Background(), keys[1])
+	assert.ErrorIs(t, err, vault.ErrInvalidKey)
+	assert.Equal(t, 0, server.Progress())
+	assert.True(t, server.Sealed())
+
+	_, err = client.Unseal(context.Background(), "not a key")
+	assert.ErrorIs(t, err, vault.ErrInvalidKey)
+}
+
+func TestServer_Restart(t *testing.T) {
+	server, client := newInitializedServer(t, 1, 1)
+	client.Unseal(context.Background(), server.Keys()[0])
+	assert.False(t, server.Sealed())
+
+	server.Restart()
+	status, err := client.SealStatus(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, status.Sealed)
+	assert.True(t, status.Initialized)
+}
+
+func TestServer_FailRequests(t *testing.T) {
+	server, client := newInitializedServer(t, 1, 1)
+	server.FailRequests("/v1/sys/unseal", 1, http.StatusInternalServerError)
+
+	_, err := client.Unseal(context.Background(), server.Keys()[0])
+	var apiError *vault.APIError
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, http.StatusInternalServerError, apiError.StatusCode)
+
+	unseal, err := client.Unseal(context.Background(), server.Keys()[0])
+	assert.Nil(t, err)
+	assert.False(t, unseal.Sealed)
+	assert.Equal(t, 2, server.Requests("/v1/sys/unseal"))
+}
+
+func TestServer_Latency(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetLatency(time.Second)
+	client, _ := vault.NewVaultClient(vault.ClientConfig{Address: server.URL, Timeouts: vault.Timeouts{Health: 50 * time.Millisecond}})
+
+	_, err := client.HealthCheck(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
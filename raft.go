@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mattgill98/vault-init/pkg/secret"
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+var (
+	raftLeaderAddresses = getListEnv("VAULT_RAFT_LEADER_ADDRS")
+	raftJoinOptions     vault.RaftJoinOptions
+
+	// raftNodeAddress identifies this node in VAULT_RAFT_LEADER_ADDRS. VAULT_ADDR is
+	// usually a loopback address, so it cannot be compared with the leader addresses.
+	raftNodeAddress = os.Getenv("VAULT_RAFT_NODE_ADDR")
+)
+
+// ValidateRaftConfig checks that a node managed by its own sidecar knows its
+// address among the leaders, so that the first leader can initialize the cluster
+func ValidateRaftConfig(clusterMode bool) error {
+	if clusterMode || len(raftLeaderAddresses) == 0 || raftNodeAddress != "" {
+		return nil
+	}
+	return fmt.Errorf("VAULT_RAFT_NODE_ADDR must be set to the address of this node as listed in VAULT_RAFT_LEADER_ADDRS")
+}
+
+// GetNodeAddress returns the address identifying the current node in single mode
+func GetNodeAddress() string {
+	if raftNodeAddress != "" {
+		return raftNodeAddress
+	}
+	return address
+}
+
+// GetRaftJoinOptions reads the TLS material presented to the leader when joining.
+// The leader address is filled in for each join attempt.
+func GetRaftJoinOptions() (vault.RaftJoinOptions, error) {
+	options := vault.RaftJoinOptions{
+		LeaderServerName: os.Getenv("VAULT_RAFT_LEADER_TLS_SERVER_NAME"),
+	}
+
+	files := map[string]*string{
+		"VAULT_RAFT_LEADER_CA_CERT":     &options.LeaderCACert,
+		"VAULT_RAFT_LEADER_CLIENT_CERT": &options.LeaderClientCert,
+		"VAULT_RAFT_LEADER_CLIENT_KEY":  &options.LeaderClientKey,
+	}
+	for name, value := range files {
+		path := os.Getenv(name)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return vault.RaftJoinOptions{}, fmt.Errorf("Failed to read %v: %w", name, err)
+		}
+		*value = string(data)
+	}
+	return options, nil
+}
+
+// ShouldJoinCluster decides whether an uninitialized node must join an existing
+// cluster rather than being initialized. Only the first configured leader may
+// initialize, and only while no keys have been stored for the cluster.
+func ShouldJoinCluster(nodeAddress string) (bool, error) {
+	if len(raftLeaderAddresses) == 0 {
+		return false, nil
+	}
+	if nodeAddress != raftLeaderAddresses[0] {
+		return true, nil
+	}
+	return HasStoredKeys()
+}
+
+// HasStoredKeys reports whether the key storage already holds the keys of an initialized
+// cluster. An unreadable storage is an error, so that stored keys are never overwritten.
+func HasStoredKeys() (bool, error) {
+	state, err := keyStorage.Fetch()
+	if errors.Is(err, secret.ErrKeysNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Unable to check for stored keys: %w", err)
+	}
+	for _, key := range append(state.Keys, state.RecoveryKeys...) {
+		if key != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// JoinCluster joins the current node to the first reachable leader, then unseals it with the stored keys
+func JoinCluster(ctx context.Context, nodeAddress string) (bool, error) {
+	for _, leader := range raftLeaderAddresses {
+		if leader == nodeAddress {
+			continue
+		}
+
+		options := raftJoinOptions
+		options.LeaderAddress = leader
+		joined, err := vaultClient.RaftJoin(ctx, options)
+		if err != nil {
+			log.Printf("Failed to join Raft leader %v: %v", leader, err)
+			continue
+		}
+		if !joined {
+			log.Printf("Raft leader %v did not accept the join request", leader)
+			continue
+		}
+
+		log.Printf("Joined Raft cluster via %v", leader)
+		if initOptions.AutoUnseal {
+			return true, nil
+		}
+		if ok, err := UnsealVault(ctx); !ok {
+			log.Printf("Failed to unseal joined node: %v", err)
+		}
+		return true, nil
+	}
+
+	log.Println("Unable to join any Raft leader, retrying later")
+	return true, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/secret"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShouldJoinCluster(t *testing.T) {
+	defer func() { raftLeaderAddresses = nil }()
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Once().Return((*vault.InitState)(nil), secret.ErrKeysNotFound)
+	mockKeyStorage.On("Fetch").Once().Return(&vault.InitState{Keys: []string{"a"}}, nil)
+
+	raftLeaderAddresses = nil
+	join, err := ShouldJoinCluster("http://vault-0:8200")
+	assert.False(t, join)
+	assert.Nil(t, err)
+
+	raftLeaderAddresses = []string{"http://vault-0:8200", "http://vault-1:8200"}
+	join, _ = ShouldJoinCluster("http://vault-2:8200")
+	assert.True(t, join)
+	join, _ = ShouldJoinCluster("http://vault-0:8200")
+	assert.False(t, join)
+	join, _ = ShouldJoinCluster("http://vault-0:8200")
+	assert.True(t, join)
+}
+
+func TestReconcileVault_LeaderRefusesToInitializeWithoutStorage(t *testing.T) {
+	raftLeaderAddresses = []string{"http://vault-0:8200"}
+	defer func() { raftLeaderAddresses = nil }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return((*vault.InitState)(nil), fmt.Errorf("Mock error"))
+
+	ok, err := ReconcileVault(context.Background(), "http://vault-0:8200", vault.HealthState{Uninitialized: true})
+	assert.False(t, ok)
+	assert.NotNil(t, err)
+	mockVault.AssertNotCalled(t, "Initialize", mock.Anything, mock.Anything)
+}
+
+func TestValidateRaftConfig(t *testing.T) {
+	defer func() { raftLeaderAddresses, raftNodeAddress = nil, "" }()
+
+	assert.Nil(t, ValidateRaftConfig(false))
+
+	raftLeaderAddresses = []string{"http://vault-0:8200"}
+	assert.NotNil(t, ValidateRaftConfig(false))
+	assert.Nil(t, ValidateRaftConfig(true))
+
+	raftNodeAddress = "http://vault-0:8200"
+	assert.Nil(t, ValidateRaftConfig(false))
+	assert.Equal(t, "http://vault-0:8200", GetNodeAddress())
+}
+
+func TestJoinCluster_FallsBackToNextLeader(t *testing.T) {
+	raftLeaderAddresses = []string{"http://vault-0:8200", "http://vault-1:8200", "http://vault-2:8200"}
+	defer func() { raftLeaderAddresses = nil }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("RaftJoin", mock.Anything, vault.RaftJoinOptions{LeaderAddress: "http://vault-0:8200"}).Once().Return(false, fmt.Errorf("Mock error"))
+	mockVault.On("RaftJoin", mock.Anything, vault.RaftJoinOptions{LeaderAddress: "http://vault-1:8200"}).Once().Return(true, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}}, nil)
+
+	ok, err := JoinCluster(context.Background(), "http://vault-2:8200")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockVault.AssertNumberOfCalls(t, "RaftJoin", 2)
+	mockVault.AssertCalled(t, "Unseal", mock.Anything, "a")
+}
+
+func TestReconcileVault_FollowerJoinsInsteadOfInitializing(t *testing.T) {
+	raftLeaderAddresses = []string{"http://vault-0:8200"}
+	defer func() { raftLeaderAddresses = nil }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("RaftJoin", mock.Anything, mock.Anything).Once().Return(true, nil)
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}}, nil)
+
+	ok, err := ReconcileVault(context.Background(), "http://vault-1:8200", vault.HealthState{Uninitialized: true})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockVault.AssertNotCalled(t, "Initialize", mock.Anything, mock.Anything)
+}
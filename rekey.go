@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	PERSIST_ATTEMPTS = 3
+)
+
+var (
+	ErrRekeyUnsupported = errors.New("Rekeying is only supported for Shamir sealed Vaults")
+)
+
+// Rekey rotates the unseal keys using the stored shares. The new keys are stored
+// before Vault verifies them, with the previous keys kept alongside them as a backup
+// until the new keys have been used to unseal Vault.
+func Rekey(ctx context.Context) error {
+	if initOptions.AutoUnseal {
+		return ErrRekeyUnsupported
+	}
+
+	current, err := keyStorage.Fetch()
+	if err != nil {
+		return fmt.Errorf("Failed to fetch keys: %w", err)
+	}
+	keys, err := GetUnsealKeys(*current)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Starting rekey...")
+	status, err := vaultClient.RekeyInit(ctx, initOptions)
+	if err != nil {
+		return fmt.Errorf("Failed to start rekey: %w", err)
+	}
+
+	result, err := submitRekeyKeys(ctx, keys, status.Nonce, vaultClient.RekeyUpdate)
+	if err != nil {
+		cancelRekey(ctx)
+		return fmt.Errorf("Rekey failed: %w", err)
+	}
+
+	// Only the keys change, the rest of the stored state is kept as it is
+	rekeyed := *current
+	rekeyed.Keys = result.Keys
+	rekeyed.KeyFingerprints = result.KeyFingerprints
+	rekeyed.Threshold = initOptions.SecretThreshold
+	rekeyed.BackupKeys = current.Keys
+	rekeyed.BackupThreshold = current.Threshold
+	rekeyed.BackupKeyFingerprints = current.KeyFingerprints
+
+	newKeys, err := GetUnsealKeys(rekeyed)
+	if err != nil {
+		cancelRekey(ctx)
+		return fmt.Errorf("Unable to verify new keys: %w", err)
+	}
+
+	// Once verified Vault only accepts the new keys, so they must be stored first.
+	// Until then the previous keys, stored as the backup, are the valid ones.
+	if err := persistRekeyedState(ctx, rekeyed); err != nil {
+		cancelRekey(ctx)
+		return fmt.Errorf("Unable to store the new keys, the previous keys remain valid: %w", err)
+	}
+
+	log.Println("Verifying new keys...")
+	if _, err := submitRekeyKeys(ctx, newKeys, result.VerificationNonce, vaultClient.RekeyVerify); err != nil {
+		cancelRekey(ctx)
+		if ok, persistErr := keyStorage.Persist(*current); !ok {
+			log.Printf("Failed to restore the previous keys, they remain stored as the backup: %v", persistErr)
+		}
+		return fmt.Errorf("Rekey verification failed, the previous keys remain valid: %w", err)
+	}
+
+	log.Println("Rekey complete, previous keys kept as a backup until the new keys unseal Vault")
+	return nil
+}
+
+func persistRekeyedState(ctx context.Context, state vault.InitState) error {
+	for attempt := 1; ; attempt++ {
+		ok, err := keyStorage.Persist(state)
+		if ok {
+			return nil
+		}
+		if attempt == PERSIST_ATTEMPTS {
+			return err
+		}
+		log.Printf("Failed to store new keys, retrying: %v", err)
+		sleep(ctx, time.Duration(attempt)*time.Second)
+	}
+}
+
+// submitRekeyKeys provides keys to a rekey or verification step until it completes
+func submitRekeyKeys(ctx context.Context, keys []string, nonce string, submit func(context.Context, string, string) (vault.RekeyState, error)) (vault.RekeyState, error) {
+	for index, key := range keys {
+		state, err := submit(ctx, key, nonce)
+		if err != nil {
+			return vault.RekeyState{}, fmt.Errorf("key [%d]: %w", index, err)
+		}
+		log.Printf("Rekey progress: [%d/%d]", state.Progress, state.Required)
+		if state.Complete {
+			return state, nil
+		}
+	}
+	return vault.RekeyState{}, fmt.Errorf("not enough keys to complete")
+}
+
+func cancelRekey(ctx context.Context) {
+	if err := vaultClient.RekeyCancel(ctx); err != nil {
+		log.Printf("Failed to cancel rekey: %v", err)
+	}
+}
+
+// ConfirmRekey drops the backup of the previous keys once the current keys have unsealed Vault
+func ConfirmRekey() {
+	// Re-read the state, as unsealing may have completed a seal migration
+	stored, err := keyStorage.Fetch()
+	if err != nil {
+		log.Printf("Failed to remove backup keys: %v", err)
+		return
+	}
+	state := *stored
+	if len(state.BackupKeys) == 0 {
+		return
+	}
+
+	state.BackupKeys = nil
+	state.BackupThreshold = 0
+	state.BackupKeyFingerprints = nil
+	if ok, err := keyStorage.Persist(state); !ok {
+		log.Printf("Failed to remove backup keys: %v", err)
+		return
+	}
+	log.Println("New unseal keys confirmed, removed backup of the previous keys")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRekey_Success(t *testing.T) {
+	initOptions = vault.InitOptions{SecretShares: 3, SecretThreshold: 2}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a", "b", "c"}, Threshold: 2, RootTokenRevoked: true}, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("RekeyInit", mock.Anything, initOptions).Once().Return(vault.RekeyState{Nonce: "n", Started: true, Required: 2}, nil)
+	mockVault.On("RekeyUpdate", mock.Anything, "a", "n").Once().Return(vault.RekeyState{Progress: 1, Required: 2}, nil)
+	mockVault.On("RekeyUpdate", mock.Anything, "b", "n").Once().Return(vault.RekeyState{Complete: true, Keys: []string{"x", "y", "z"}, VerificationNonce: "v"}, nil)
+	mockVault.On("RekeyVerify", mock.Anything, "x", "v").Once().Return(vault.RekeyState{Progress: 1, Required: 2}, nil)
+	mockVault.On("RekeyVerify", mock.Anything, "y", "v").Once().Return(vault.RekeyState{Complete: true}, nil)
+
+	expected := vault.InitState{
+		Keys:             []string{"x", "y", "z"},
+		Threshold:        2,
+		RootTokenRevoked: true,
+		BackupKeys:       []string{"a", "b", "c"},
+		BackupThreshold:  2,
+	}
+	mockKeyStorage.On("Persist", expected).Once().Return(true, nil)
+
+	err := Rekey(context.Background())
+	assert.Nil(t, err)
+	mockKeyStorage.AssertCalled(t, "Persist", expected)
+	mockVault.AssertNotCalled(t, "RekeyUpdate", mock.Anything, "c", mock.Anything)
+}
+
+func TestRekey_VerificationFailed(t *testing.T) {
+	initOptions = vault.InitOptions{SecretShares: 1, SecretThreshold: 1}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, Threshold: 1}, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("RekeyInit", mock.Anything, initOptions).Once().Return(vault.RekeyState{Nonce: "n"}, nil)
+	mockVault.On("RekeyUpdate", mock.Anything, "a", "n").Once().Return(vault.RekeyState{Complete: true, Keys: []string{"x"}, VerificationNonce: "v"}, nil)
+	mockVault.On("RekeyVerify", mock.Anything, "x", "v").Once().Return(vault.RekeyState{}, fmt.Errorf("Mock error"))
+	mockVault.On("RekeyCancel", mock.Anything).Once().Return(nil)
+	pending := vault.InitState{Keys: []string{"x"}, Threshold: 1, BackupKeys: []string{"a"}, BackupThreshold: 1}
+	mockKeyStorage.On("Persist", pending).Once().Return(true, nil)
+	mockKeyStorage.On("Persist", vault.InitState{Keys: []string{"a"}, Threshold: 1}).Once().Return(true, nil)
+
+	err := Rekey(context.Background())
+	assert.Contains(t, err.Error(), "previous keys remain valid")
+	mockVault.AssertCalled(t, "RekeyCancel", mock.Anything)
+	mockKeyStorage.AssertNumberOfCalls(t, "Persist", 2)
+}
+
+func TestRekey_StoresKeysBeforeVerifying(t *testing.T) {
+	initOptions = vault.InitOptions{SecretShares: 1, SecretThreshold: 1}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{Keys: []string{"a"}, Threshold: 1}, nil)
+	mockKeyStorage.On("Persist", mock.Anything).Return(false, fmt.Errorf("Mock error"))
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("RekeyInit", mock.Anything, initOptions).Once().Return(vault.RekeyState{Nonce: "n"}, nil)
+	mockVault.On("RekeyUpdate", mock.Anything, "a", "n").Once().Return(vault.RekeyState{Complete: true, Keys: []string{"x"}, VerificationNonce: "v"}, nil)
+	mockVault.On("RekeyCancel", mock.Anything).Once().Return(nil)
+
+	err := Rekey(context.Background())
+	assert.Contains(t, err.Error(), "previous keys remain valid")
+	mockKeyStorage.AssertNumberOfCalls(t, "Persist", PERSIST_ATTEMPTS)
+	mockVault.AssertNotCalled(t, "RekeyVerify", mock.Anything, mock.Anything, mock.Anything)
+	mockVault.AssertCalled(t, "RekeyCancel", mock.Anything)
+}
+
+func TestRekey_AutoUnseal(t *testing.T) {
+	initOptions = vault.InitOptions{AutoUnseal: true}
+	defer func() { initOptions = vault.InitOptions{} }()
+
+	assert.ErrorIs(t, Rekey(context.Background()), ErrRekeyUnsupported)
+}
+
+func TestUnsealVault_ConfirmsRekey(t *testing.T) {
+	state := vault.InitState{Keys: []string{"x"}, Threshold: 1, BackupKeys: []string{"a"}, BackupThreshold: 1}
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&state, nil)
+	mockKeyStorage.On("Persist", vault.InitState{Keys: []string{"x"}, Threshold: 1}).Once().Return(true, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "x").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	ok, err := UnsealVault(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertNumberOfCalls(t, "Persist", 1)
+}
+
+func TestUnsealVault_FallsBackToBackupKeys(t *testing.T) {
+	state := vault.InitState{Keys: []string{"x"}, Threshold: 1, BackupKeys: []string{"a"}, BackupThreshold: 1}
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&state, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: true, Threshold: 1}, nil)
+	mockVault.On("Unseal", mock.Anything, "x").Once().Return(vault.UnsealState{}, fmt.Errorf("Mock error"))
+	mockVault.On("Unseal", mock.Anything, "a").Once().Return(vault.UnsealState{Sealed: false}, nil)
+
+	ok, err := UnsealVault(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertNotCalled(t, "Persist", mock.Anything)
+}
+
+func TestUnsealVault_KeepsBackupWhenAlreadyUnsealed(t *testing.T) {
+	state := vault.InitState{Keys: []string{"x"}, Threshold: 1, BackupKeys: []string{"a"}, BackupThreshold: 1}
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&state, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("SealStatus", mock.Anything).Return(vault.SealState{Sealed: false}, nil)
+
+	ok, err := UnsealVault(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	mockKeyStorage.AssertNotCalled(t, "Persist", mock.Anything)
+}
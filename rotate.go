@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/metrics"
+	"github.com/mattgill98/vault-init/pkg/vault"
+)
+
+const (
+	DEFAULT_ROTATION_CHECK_INTERVAL = time.Hour
+	ROTATION_RETRY_INTERVAL         = time.Minute
+)
+
+var (
+	// rotationInterval is the maximum age of the barrier encryption key, 0 disables rotation
+	rotationInterval = getDurationEnv("VAULT_ROTATION_INTERVAL", 0)
+	// rotationCheckInterval is the longest time between reads of sys/key-status
+	rotationCheckInterval = getDurationEnv("VAULT_ROTATION_CHECK_INTERVAL", DEFAULT_ROTATION_CHECK_INTERVAL)
+	nextRotationCheck     time.Time
+	metricsRegistry       = metrics.NewRegistry()
+)
+
+// CheckKeyRotation rotates the barrier encryption key when it is due, checking
+// sys/key-status at most once per check interval
+func CheckKeyRotation(ctx context.Context) {
+	now := time.Now()
+	if rotationInterval == 0 || now.Before(nextRotationCheck) {
+		return
+	}
+
+	next, err := RotateIfDue(ctx, now)
+	if err != nil {
+		log.Printf("Key rotation check failed: %v", err)
+		next = now.Add(ROTATION_RETRY_INTERVAL)
+	}
+	nextRotationCheck = next
+}
+
+// RotateIfDue rotates the barrier key if it was installed more than the rotation
+// interval ago, returning when rotation should next be checked
+func RotateIfDue(ctx context.Context, now time.Time) (time.Time, error) {
+	token, err := getOperatorToken()
+	if err != nil {
+		return time.Time{}, err
+	}
+	status, err := vaultClient.KeyStatus(ctx, token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to read key status: %w", err)
+	}
+	recordKeyStatus(status)
+
+	due := status.InstallTime.Add(rotationInterval)
+	if now.Before(due) {
+		if debugLogging {
+			log.Printf("Encryption key term %d is due for rotation at %v", status.Term, due)
+		}
+		return nextCheck(now, due), nil
+	}
+
+	log.Printf("Rotating encryption key term %d installed at %v...", status.Term, status.InstallTime)
+	if err := vaultClient.Rotate(ctx, token); err != nil {
+		return time.Time{}, fmt.Errorf("Failed to rotate the encryption key: %w", err)
+	}
+	metricsRegistry.Add("vault_init_key_rotations_total", "Number of encryption key rotations performed", 1)
+
+	status, err = vaultClient.KeyStatus(ctx, token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to read key status: %w", err)
+	}
+	recordKeyStatus(status)
+	RecordAuditEvent("rotate", map[string]string{"term": fmt.Sprint(status.Term)})
+	log.Printf("Encryption key rotated to term %d", status.Term)
+
+	return nextCheck(now, status.InstallTime.Add(rotationInterval)), nil
+}
+
+func nextCheck(now time.Time, due time.Time) time.Time {
+	next := now.Add(rotationCheckInterval)
+	if due.Before(next) {
+		return due
+	}
+	return next
+}
+
+func recordKeyStatus(status vault.KeyState) {
+	metricsRegistry.Set("vault_init_key_term", "Term of the current encryption key", float64(status.Term))
+	metricsRegistry.Set("vault_init_key_install_time_seconds", "Unix time the current encryption key was installed", float64(status.InstallTime.Unix()))
+}
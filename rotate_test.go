@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/mocking"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRotateIfDue_Rotates(t *testing.T) {
+	rotationInterval = 90 * 24 * time.Hour
+	defer func() { rotationInterval = 0 }()
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{RootToken: "root"}, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("KeyStatus", mock.Anything, "root").Once().Return(vault.KeyState{Term: 1, InstallTime: now.Add(-100 * 24 * time.Hour)}, nil)
+	mockVault.On("Rotate", mock.Anything, "root").Once().Return(nil)
+	mockVault.On("KeyStatus", mock.Anything, "root").Once().Return(vault.KeyState{Term: 2, InstallTime: now}, nil)
+
+	next, err := RotateIfDue(context.Background(), now)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(rotationCheckInterval), next)
+	assert.Equal(t, 2.0, metricsRegistry.Value("vault_init_key_term"))
+	assert.Equal(t, float64(now.Unix()), metricsRegistry.Value("vault_init_key_install_time_seconds"))
+	mockVault.AssertCalled(t, "Rotate", mock.Anything, "root")
+}
+
+func TestRotateIfDue_NotDue(t *testing.T) {
+	rotationInterval = 90 * 24 * time.Hour
+	defer func() { rotationInterval = 0 }()
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	installed := now.Add(-90*24*time.Hour + 10*time.Minute)
+
+	mockKeyStorage := new(mocking.KeyStorageMock)
+	keyStorage = mockKeyStorage
+	mockKeyStorage.On("Fetch").Return(&vault.InitState{RootToken: "root"}, nil)
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+	mockVault.On("KeyStatus", mock.Anything, "root").Once().Return(vault.KeyState{Term: 1, InstallTime: installed}, nil)
+
+	next, err := RotateIfDue(context.Background(), now)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(10*time.Minute), next)
+	mockVault.AssertNotCalled(t, "Rotate", mock.Anything, mock.Anything)
+}
+
+func TestCheckKeyRotation_Disabled(t *testing.T) {
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+
+	CheckKeyRotation(context.Background())
+	mockVault.AssertNotCalled(t, "KeyStatus", mock.Anything, mock.Anything)
+}
+
+func TestRunMaintenance_StandbyDoesNotRotate(t *testing.T) {
+	previousAuditCheck := auditCheck
+	rotationInterval, auditCheck = 90*24*time.Hour, false
+	defer func() { rotationInterval, auditCheck = 0, previousAuditCheck }()
+
+	mockVault := new(mocking.VaultMock)
+	vaultClient = mockVault
+
+	runMaintenance(context.Background(), vault.HealthState{Standby: true})
+	mockVault.AssertNotCalled(t, "KeyStatus", mock.Anything, mock.Anything)
+}
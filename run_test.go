@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mattgill98/vault-init/pkg/secret"
+	"github.com/mattgill98/vault-init/pkg/vault"
+	"github.com/mattgill98/vault-init/pkg/vault/vaulttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeVault(t *testing.T) *vaulttest.Server {
+	server := vaulttest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := vault.NewVaultClient(vault.ClientConfig{Address: server.URL})
+	assert.Nil(t, err)
+	previousClient, previousStorage := vaultClient, keyStorage
+	vaultClient = client
+	keyStorage = secret.NewMemorySecretStorage(nil)
+	initOptions = vault.InitOptions{SecretShares: 5, SecretThreshold: 3}
+	t.Cleanup(func() {
+		vaultClient, keyStorage = previousClient, previousStorage
+		initOptions = vault.InitOptions{}
+	})
+	return server
+}
+
+func TestRun_InitializesAndUnsealsFakeVault(t *testing.T) {
+	server := newFakeVault(t)
+
+	ok, err := run(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.True(t, server.Initialized())
+	assert.False(t, server.Sealed())
+
+	state, _ := keyStorage.Fetch()
+	assert.Equal(t, server.Keys(), state.Keys)
+	assert.Equal(t, 3, state.Threshold)
+	assert.Equal(t, server.RootToken(), state.RootToken)
+}
+
+func TestRun_UnsealsFakeVaultAfterRestart(t *testing.T) {
+	server := newFakeVault(t)
+	run(context.Background())
+
+	server.Restart()
+	ok, err := run(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.False(t, server.Sealed())
+}
+
+func TestRun_ResetsStaleProgressOnFakeVault(t *testing.T) {
+	server := newFakeVault(t)
+	run(context.Background())
+	server.Restart()
+
+	// An abandoned unseal attempt with a key that is not part of the stored state
+	vaultClient.Unseal(context.Background(), "00112233445566778899aabbccddeeff")
+	assert.Equal(t, 1, server.Progress())
+
+	ok, err := run(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.False(t, server.Sealed())
+}
+
+func TestRun_RetriesFakeVaultFailures(t *testing.T) {
+	server := newFakeVault(t)
+	server.FailRequests("/v1/sys/init", 1, http.StatusInternalServerError)
+
+	ok, err := run(context.Background())
+	assert.False(t, ok)
+	assert.NotNil(t, err)
+	assert.False(t, server.Initialized())
+
+	ok, err = run(context.Background())
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.False(t, server.Sealed())
+}
+
+func TestRun_ReportsRejectedKeyOnFakeVault(t *testing.T) {
+	server := newFakeVault(t)
+	initOptions = vault.InitOptions{SecretShares: 3, SecretThreshold: 2}
+	run(context.Background())
+	server.Restart()
+	server.RejectKey(server.Keys()[0])
+
+	// Vault only verifies the keys once the threshold is reached, discarding the
+	// progress, so Vault stays sealed
+	ok, err := run(context.Background())
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, vault.ErrInvalidKey)
+	var unsealErr *UnsealError
+	assert.ErrorAs(t, err, &unsealErr)
+	assert.Equal(t, []int{1}, unsealErr.Failed)
+	assert.True(t, server.Sealed())
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattgill98/vault-init/pkg/snapshot"
+)
+
+const (
+	SNAPSHOT_RETRY_INTERVAL = 5 * time.Minute
+)
+
+var (
+	// snapshotInterval is the time between Raft snapshots, 0 disables them
+	snapshotInterval = getDurationEnv("VAULT_SNAPSHOT_INTERVAL", 0)
+	snapshotManager  *snapshot.Manager
+	nextSnapshot     time.Time
+)
+
+// GetSnapshotManager configures the snapshot sink, either a local directory
+// (which may be a mounted volume) or an S3 compatible bucket
+func GetSnapshotManager() (*snapshot.Manager, error) {
+	retention := snapshot.Retention{
+		Count:  getIntEnv("VAULT_SNAPSHOT_RETAIN", 0),
+		MaxAge: getDurationEnv("VAULT_SNAPSHOT_MAX_AGE", 0),
+	}
+
+	if dir := os.Getenv("VAULT_SNAPSHOT_DIR"); dir != "" {
+		sink, err := snapshot.NewLocalSink(dir)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.NewManager(sink, retention), nil
+	}
+
+	if bucket := os.Getenv("VAULT_SNAPSHOT_S3_BUCKET"); bucket != "" {
+		sink, err := snapshot.NewS3Sink(snapshot.S3Config{
+			Endpoint:        os.Getenv("VAULT_SNAPSHOT_S3_ENDPOINT"),
+			Region:          os.Getenv("VAULT_SNAPSHOT_S3_REGION"),
+			Bucket:          bucket,
+			Prefix:          os.Getenv("VAULT_SNAPSHOT_S3_PREFIX"),
+			AccessKeyID:     os.Getenv("VAULT_SNAPSHOT_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("VAULT_SNAPSHOT_S3_SECRET_ACCESS_KEY"),
+			Insecure:        strings.EqualFold(os.Getenv("VAULT_SNAPSHOT_S3_INSECURE"), "true"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.NewManager(sink, retention), nil
+	}
+
+	if snapshotInterval > 0 {
+		return nil, fmt.Errorf("VAULT_SNAPSHOT_INTERVAL requires VAULT_SNAPSHOT_DIR or VAULT_SNAPSHOT_S3_BUCKET")
+	}
+	return nil, nil
+}
+
+// CheckSnapshot takes a snapshot once the snapshot interval has passed
+func CheckSnapshot(ctx context.Context) {
+	now := time.Now()
+	if snapshotInterval == 0 || snapshotManager == nil || now.Before(nextSnapshot) {
+		return
+	}
+
+	if err := TakeSnapshot(ctx, now); err != nil {
+		log.Printf("Snapshot failed: %v", err)
+		metricsRegistry.Add("vault_init_snapshot_failures_total", "Number of failed Raft snapshots", 1)
+		nextSnapshot = now.Add(SNAPSHOT_RETRY_INTERVAL)
+		return
+	}
+	nextSnapshot = now.Add(snapshotInterval)
+}
+
+func TakeSnapshot(ctx context.Context, now time.Time) error {
+	token, err := getOperatorToken()
+	if err != nil {
+		return err
+	}
+	log.Println("Taking Raft snapshot...")
+	name, err := snapshotManager.Backup(ctx, vaultClient, token, now)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stored snapshot %v", name)
+	metricsRegistry.Set("vault_init_last_snapshot_time_seconds", "Unix time of the last successful Raft snapshot", float64(now.Unix()))
+	return nil
+}
+
+// RestoreSnapshot installs a stored snapshot, the latest if no name is given,
+// then runs the unseal flow in case the restored data uses different keys
+func RestoreSnapshot(ctx context.Context, name string, force bool) error {
+	if snapshotManager == nil {
+		return fmt.Errorf("No snapshot storage is configured")
+	}
+	token, err := getOperatorToken()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if name, err = snapshotManager.Latest(ctx); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Restoring snapshot %v...", name)
+	if err := snapshotManager.Restore(ctx, vaultClient, token, name, force); err != nil {
+		return err
+	}
+	RecordAuditEvent("restore", map[string]string{"snapshot": name, "force": fmt.Sprint(force)})
+	log.Printf("Restored snapshot %v", name)
+
+	var ok bool
+	if IsClusterMode() {
+		ok, err = runCluster(ctx)
+	} else {
+		ok, err = run(ctx)
+	}
+	if !ok {
+		return fmt.Errorf("Unsealing after restore failed: %w", err)
+	}
+	return nil
+}
+
+func runRestore(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	force := flags.Bool("force", false, "Restore a snapshot taken from a different cluster or with different keys")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return RestoreSnapshot(ctx, flags.Arg(0), *force)
+}